@@ -68,7 +68,17 @@ func getConnector(ctx context.Context, ghc *cfg.SonatypeNexus) (types.ConnectorS
 		return nil, fmt.Errorf("password is required")
 	}
 
-	cb, err := connector.New(ctx, host, username, password)
+	opts := connector.Options{
+		DefaultRoles:             ghc.GetStringSlice(cfg.DefaultRolesField.FieldName),
+		PasswordMinLength:        int64(ghc.GetInt(cfg.PasswordMinLengthField.FieldName)),
+		PasswordCharacterClasses: ghc.GetStringSlice(cfg.PasswordCharacterClassesField.FieldName),
+		ServiceAccountPatterns:   ghc.GetStringSlice(cfg.ServiceAccountPatternsField.FieldName),
+		DeleteMode:               ghc.GetString(cfg.DeleteModeField.FieldName),
+		StrippedUserRole:         ghc.GetString(cfg.StrippedUserRoleField.FieldName),
+		ProtectedUserIDs:         ghc.GetStringSlice(cfg.ProtectedUserIDsField.FieldName),
+	}
+
+	cb, err := connector.New(ctx, host, username, password, opts)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -11,11 +11,22 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type APIClient struct {
 	baseURL string
 	wrapper *uhttp.BaseHttpClient
+
+	userSources snapshot[[]UserSource]
+	users       snapshot[[]*User]
+	roles       snapshot[[]Role]
+	privileges  snapshot[[]Privilege]
+	ldapServers snapshot[[]LDAPServer]
+
+	userLocks keyedLocks
+	roleLocks keyedLocks
 }
 
 type NexusErrorResponse struct {
@@ -26,10 +37,35 @@ func (e *NexusErrorResponse) Message() string {
 	return e.ErrorMessage
 }
 
-const baseUsersEndpoint = "%s/service/rest/v1/security/users"
+const (
+	baseUsersEndpoint          = "%s/service/rest/v1/security/users"
+	userSourcesEndpoint        = "%s/service/rest/v1/security/user-sources"
+	baseRolesEndpoint          = "%s/service/rest/v1/security/roles"
+	basePrivilegesEndpoint     = "%s/service/rest/v1/security/privileges"
+	contentSelectorsEndpoint   = "%s/service/rest/v1/security/content-selectors"
+	repositoriesEndpoint       = "%s/service/rest/v1/repositories"
+	repositorySettingsEndpoint = "%s/service/rest/v1/repositorySettings"
+	ldapServersEndpoint        = "%s/service/rest/v1/security/ldap"
+	statusEndpoint             = "%s/service/rest/v1/status"
+)
+
+const (
+	// DefaultUserSource is the source of users stored in Nexus itself.
+	DefaultUserSource = "default"
+	// LDAPUserSource is the source of users and role mappings coming from LDAP servers.
+	LDAPUserSource = "LDAP"
+
+	// userSearchLimit is the most users Nexus returns for a search on any source other than default.
+	userSearchLimit = 100
+	// maxUserSearchPrefix bounds how long a user ID prefix gets while subdividing a capped search.
+	maxUserSearchPrefix = 32
+	// userSearchAlphabet holds the characters appended to a prefix to subdivide a capped search.
+	userSearchAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789._-@"
+)
 
 // doRequest executes an HTTP request and processes the response.
-func (c *APIClient) doRequest(ctx context.Context, method, endpointUrl string, reqBody, res any) (http.Header, annotations.Annotations, error) {
+// Request options are applied after the JSON defaults, so they can replace the body or content type.
+func (c *APIClient) doRequest(ctx context.Context, method, endpointUrl string, reqBody, res any, requestOptions ...uhttp.RequestOption) (http.Header, annotations.Annotations, error) {
 	logger := ctxzap.Extract(ctx)
 
 	urlAddress, err := url.Parse(endpointUrl)
@@ -46,6 +82,8 @@ func (c *APIClient) doRequest(ctx context.Context, method, endpointUrl string, r
 		options = append(options, uhttp.WithJSONBody(reqBody))
 	}
 
+	options = append(options, requestOptions...)
+
 	request, err := c.wrapper.NewRequest(ctx, method, urlAddress, options...)
 	if err != nil {
 		logger.Error("failed to create request", zap.Error(err))
@@ -84,6 +122,15 @@ func (c *APIClient) doRequest(ctx context.Context, method, endpointUrl string, r
 		return nil, nil, fmt.Errorf("request failed: %s", errorResp.Message())
 	}
 
+	// Drop cached listings after a write, so that the reads following it, such as verifying an update, observe the change.
+	if method != http.MethodGet {
+		c.invalidateSnapshots()
+		err = uhttp.ClearCaches(ctx)
+		if err != nil {
+			logger.Warn("failed to clear the HTTP cache", zap.Error(err))
+		}
+	}
+
 	annotation := annotations.Annotations{}
 	annotation.Append(&rateLimitDesc)
 	return resp.Header, annotation, nil
@@ -109,6 +156,22 @@ func NewClient(ctx context.Context, baseURL, username, password string, httpClie
 	}, nil
 }
 
+// GetStatus checks that Nexus is reachable and able to serve read requests.
+// https://help.sonatype.com/en/api-reference.html#operations-tag-Status .
+func (c *APIClient) GetStatus(ctx context.Context) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(statusEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, nil)
+	if err != nil {
+		l.Error("Error getting status", zap.Error(err))
+		return nil, fmt.Errorf("error getting status: %w", err)
+	}
+
+	return annotation, nil
+}
+
 // CreateUser creates a new user in Nexus.
 func (c *APIClient) CreateUser(ctx context.Context, payload *UserCreatePayload) (*User, annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
@@ -142,12 +205,127 @@ func (c *APIClient) ListUsers(ctx context.Context) ([]*User, annotations.Annotat
 	return users, annotation, nil
 }
 
+// ListUserSources returns the user sources configured in Nexus, such as default, LDAP or Crowd.
+// https://help.sonatype.com/en/api-reference.html#operations-tag-Security%20management:%20users .
+func (c *APIClient) ListUserSources(ctx context.Context) ([]UserSource, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var sources []UserSource
+	queryUrl := fmt.Sprintf(userSourcesEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &sources)
+	if err != nil {
+		l.Error("Error getting user sources", zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting user sources: %w", err)
+	}
+
+	return sources, annotation, nil
+}
+
+// ListUsersBySource returns the users of a single source whose ID starts with userIDPrefix.
+func (c *APIClient) ListUsersBySource(ctx context.Context, source, userIDPrefix string) ([]*User, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	query := url.Values{}
+	query.Set("source", source)
+	if userIDPrefix != "" {
+		query.Set("userId", userIDPrefix)
+	}
+
+	var users []*User
+	queryUrl := fmt.Sprintf(baseUsersEndpoint+"?%s", c.baseURL, query.Encode())
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &users)
+	if err != nil {
+		l.Error("Error getting users", zap.String("source", source), zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting users of source %s: %w", source, err)
+	}
+
+	return users, annotation, nil
+}
+
+// ListAllUsers returns the users of every configured user source, each tagged with its source.
+// A user ID can exist in more than one source, such as a local and an LDAP account, and each of
+// these accounts is returned. Searches on sources other than default are capped by Nexus, so a
+// capped search is repeated with longer user ID prefixes until every result set is below the cap.
+func (c *APIClient) ListAllUsers(ctx context.Context) ([]*User, error) {
+	sources, err := c.UserSourcesSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		sourceUsers, err := c.listUsersByPrefix(ctx, source.ID, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// Subdivided searches overlap, since a capped result is kept next to the longer prefixes.
+		for _, user := range sourceUsers {
+			if user.Source == "" {
+				user.Source = source.ID
+			}
+			key := user.Source + "/" + user.UserID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// listUsersByPrefix returns the users of a source whose ID starts with prefix. A capped search is subdivided by
+// appending each character of userSearchAlphabet to the prefix, so users whose ID continues with any other character,
+// such as an uppercase letter on a case-sensitive directory, a space or a non-ASCII letter, can be missing.
+func (c *APIClient) listUsersByPrefix(ctx context.Context, source, prefix string) ([]*User, error) {
+	l := ctxzap.Extract(ctx)
+
+	users, _, err := c.ListUsersBySource(ctx, source, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == DefaultUserSource || len(users) < userSearchLimit {
+		return users, nil
+	}
+
+	if len(prefix) >= maxUserSearchPrefix {
+		l.Warn("user search is still capped at the longest prefix, some users may be missing",
+			zap.String("source", source),
+			zap.String("prefix", prefix),
+		)
+		return users, nil
+	}
+
+	l.Info("user search is capped, repeating it with longer prefixes, users whose ID continues with a character outside the search alphabet may be missing",
+		zap.String("source", source),
+		zap.String("prefix", prefix),
+		zap.String("alphabet", userSearchAlphabet),
+	)
+
+	// The capped result is kept, as it may hold the user whose ID is exactly the prefix.
+	for _, r := range userSearchAlphabet {
+		more, err := c.listUsersByPrefix(ctx, source, prefix+string(r))
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, more...)
+	}
+
+	return users, nil
+}
+
 // ListRoles returns a list of all roles in Nexus.
 func (c *APIClient) ListRoles(ctx context.Context) ([]Role, annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
 	var roles []Role
-	queryUrl := fmt.Sprintf("%s/service/rest/v1/security/roles", c.baseURL)
+	queryUrl := fmt.Sprintf(baseRolesEndpoint, c.baseURL)
 
 	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &roles)
 	if err != nil {
@@ -158,6 +336,178 @@ func (c *APIClient) ListRoles(ctx context.Context) ([]Role, annotations.Annotati
 	return roles, annotation, nil
 }
 
+// GetRole returns a single role from Nexus.
+func (c *APIClient) GetRole(ctx context.Context, roleID string) (*Role, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var role Role
+	queryUrl := fmt.Sprintf(baseRolesEndpoint+"/%s", c.baseURL, url.PathEscape(roleID))
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &role)
+	if err != nil {
+		l.Error("Error getting role", zap.String("role_id", roleID), zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting role %s: %w", roleID, err)
+	}
+
+	return &role, annotation, nil
+}
+
+// CreateRole creates a role in Nexus.
+func (c *APIClient) CreateRole(ctx context.Context, role *RolePayload) (*Role, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var createdRole Role
+	queryUrl := fmt.Sprintf(baseRolesEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodPost, queryUrl, role, &createdRole)
+	if err != nil {
+		l.Error("Error creating role", zap.String("role_id", role.ID), zap.Error(err))
+		return nil, nil, fmt.Errorf("error creating role %s: %w", role.ID, err)
+	}
+
+	return &createdRole, annotation, nil
+}
+
+// UpdateRole replaces the name, description, privileges and nested roles of a role in Nexus.
+func (c *APIClient) UpdateRole(ctx context.Context, roleID string, role *RolePayload) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(baseRolesEndpoint+"/%s", c.baseURL, url.PathEscape(roleID))
+
+	_, annotation, err := c.doRequest(ctx, http.MethodPut, queryUrl, role, nil)
+	if err != nil {
+		l.Error("Error updating role", zap.String("role_id", roleID), zap.Error(err))
+		return nil, fmt.Errorf("error updating role %s: %w", roleID, err)
+	}
+
+	return annotation, nil
+}
+
+// DeleteRole deletes a role from Nexus.
+func (c *APIClient) DeleteRole(ctx context.Context, roleID string) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(baseRolesEndpoint+"/%s", c.baseURL, url.PathEscape(roleID))
+
+	_, annotation, err := c.doRequest(ctx, http.MethodDelete, queryUrl, nil, nil)
+	if err != nil {
+		l.Error("Error deleting role", zap.String("role_id", roleID), zap.Error(err))
+		return nil, fmt.Errorf("error deleting role %s: %w", roleID, err)
+	}
+
+	return annotation, nil
+}
+
+// ListPrivileges returns a list of all privileges in Nexus.
+// https://help.sonatype.com/en/api-reference.html#operations-tag-Security%20management:%20privileges .
+func (c *APIClient) ListPrivileges(ctx context.Context) ([]Privilege, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var privileges []Privilege
+	queryUrl := fmt.Sprintf(basePrivilegesEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &privileges)
+	if err != nil {
+		l.Error("Error getting privileges", zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting privileges: %w", err)
+	}
+
+	return privileges, annotation, nil
+}
+
+// CreatePrivilege creates a privilege of the given type, such as repository-view or wildcard, in Nexus.
+func (c *APIClient) CreatePrivilege(ctx context.Context, privilegeType string, privilege *PrivilegePayload) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(basePrivilegesEndpoint+"/%s", c.baseURL, url.PathEscape(privilegeType))
+
+	_, annotation, err := c.doRequest(ctx, http.MethodPost, queryUrl, privilege, nil)
+	if err != nil {
+		l.Error("Error creating privilege", zap.String("privilege_name", privilege.Name), zap.String("privilege_type", privilegeType), zap.Error(err))
+		return nil, fmt.Errorf("error creating %s privilege %s: %w", privilegeType, privilege.Name, err)
+	}
+
+	return annotation, nil
+}
+
+// DeletePrivilege deletes a privilege from Nexus.
+func (c *APIClient) DeletePrivilege(ctx context.Context, name string) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(basePrivilegesEndpoint+"/%s", c.baseURL, url.PathEscape(name))
+
+	_, annotation, err := c.doRequest(ctx, http.MethodDelete, queryUrl, nil, nil)
+	if err != nil {
+		l.Error("Error deleting privilege", zap.String("privilege_name", name), zap.Error(err))
+		return nil, fmt.Errorf("error deleting privilege %s: %w", name, err)
+	}
+
+	return annotation, nil
+}
+
+// ListContentSelectors returns a list of all content selectors in Nexus.
+func (c *APIClient) ListContentSelectors(ctx context.Context) ([]ContentSelector, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var selectors []ContentSelector
+	queryUrl := fmt.Sprintf(contentSelectorsEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &selectors)
+	if err != nil {
+		l.Error("Error getting content selectors", zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting content selectors: %w", err)
+	}
+
+	return selectors, annotation, nil
+}
+
+// ListRepositories returns a list of all repositories in Nexus.
+// It uses the settings variant of the repositories listing, which also includes the
+// online flag and storage configuration of each repository. Reading the settings requires
+// nx-repository-admin-*-*-read, so accounts without it fall back to the plain listing.
+// https://help.sonatype.com/en/api-reference.html#operations-tag-Repository%20Management .
+func (c *APIClient) ListRepositories(ctx context.Context) ([]Repository, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var repositories []Repository
+	queryUrl := fmt.Sprintf(repositorySettingsEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &repositories)
+	if status.Code(err) == codes.PermissionDenied {
+		l.Warn(
+			"cannot read the repository settings, online status and blob stores are not synced, assign the account a role with the nx-repository-admin-*-*-read privilege",
+			zap.Error(err),
+		)
+
+		repositories = nil
+		queryUrl = fmt.Sprintf(repositoriesEndpoint, c.baseURL)
+		_, annotation, err = c.doRequest(ctx, http.MethodGet, queryUrl, nil, &repositories)
+	}
+	if err != nil {
+		l.Error("Error getting repositories", zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting repositories: %w", err)
+	}
+
+	return repositories, annotation, nil
+}
+
+// ListLDAPServers returns the LDAP servers configured in Nexus.
+// https://help.sonatype.com/en/api-reference.html#operations-tag-Security%20management:%20LDAP .
+func (c *APIClient) ListLDAPServers(ctx context.Context) ([]LDAPServer, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	var servers []LDAPServer
+	queryUrl := fmt.Sprintf(ldapServersEndpoint, c.baseURL)
+
+	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &servers)
+	if err != nil {
+		l.Error("Error getting LDAP servers", zap.Error(err))
+		return nil, nil, fmt.Errorf("error getting LDAP servers: %w", err)
+	}
+
+	return servers, annotation, nil
+}
+
 // DeleteUser deletes a user in Nexus.
 func (c *APIClient) DeleteUser(ctx context.Context, userID string) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
@@ -188,11 +538,30 @@ func (c *APIClient) UpdateUser(ctx context.Context, userID string, payload *User
 	return annotation, nil
 }
 
+// ChangePassword sets a new password for a user in Nexus.
+func (c *APIClient) ChangePassword(ctx context.Context, userID, password string) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	queryUrl := fmt.Sprintf(baseUsersEndpoint+"/%s/change-password", c.baseURL, url.PathEscape(userID))
+
+	// The endpoint expects the new password as a plain text body.
+	_, annotation, err := c.doRequest(ctx, http.MethodPut, queryUrl, nil, nil,
+		uhttp.WithBody([]byte(password)),
+		uhttp.WithContentType("text/plain"),
+	)
+	if err != nil {
+		l.Error("Error changing user password", zap.String("user_id", userID), zap.Error(err))
+		return nil, fmt.Errorf("error changing password of user %s: %w", userID, err)
+	}
+
+	return annotation, nil
+}
+
 func (c *APIClient) ListUsersByID(ctx context.Context, userId string) ([]*User, annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
 	var users []*User
-	queryUrl := fmt.Sprintf(baseUsersEndpoint+"?userId=%s", c.baseURL, userId)
+	queryUrl := fmt.Sprintf(baseUsersEndpoint+"?userId=%s", c.baseURL, url.QueryEscape(userId))
 
 	_, annotation, err := c.doRequest(ctx, http.MethodGet, queryUrl, nil, &users)
 	if err != nil {
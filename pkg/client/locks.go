@@ -0,0 +1,38 @@
+package client
+
+import "sync"
+
+// keyedLocks serializes read-modify-write updates of users and roles, since Nexus replaces the whole
+// object on update and two concurrent updates built from the same read would silently drop one of the changes.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *keyedLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	keyLock, ok := l.locks[key]
+	if !ok {
+		keyLock = &sync.Mutex{}
+		l.locks[key] = keyLock
+	}
+	l.mu.Unlock()
+
+	keyLock.Lock()
+	return keyLock.Unlock
+}
+
+// LockUser blocks until no other update of the user is in progress in this client and returns the
+// function that releases the user. Callers hold it across reading, updating and verifying the user.
+func (c *APIClient) LockUser(userID string) func() {
+	return c.userLocks.lock(userID)
+}
+
+// LockRole blocks until no other update of the role is in progress in this client and returns the
+// function that releases the role. Callers hold it across reading, updating and verifying the role.
+func (c *APIClient) LockRole(roleID string) func() {
+	return c.roleLocks.lock(roleID)
+}
@@ -8,13 +8,64 @@ type User struct {
 	Status       string   `json:"status"`
 	Source       string   `json:"source"`
 	Roles        []string `json:"roles"`
+	// ExternalRoles are mapped from the user's LDAP groups or SAML attributes and cannot be changed in Nexus.
+	ExternalRoles []string `json:"externalRoles,omitempty"`
+}
+
+type UserSource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
 type Role struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Source      string `json:"source"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Source      string   `json:"source"`
+	ReadOnly    bool     `json:"readOnly"`
+	Privileges  []string `json:"privileges"`
+	Roles       []string `json:"roles"`
+}
+
+type Privilege struct {
+	Type            string   `json:"type"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	ReadOnly        bool     `json:"readOnly"`
+	Domain          string   `json:"domain,omitempty"`
+	Format          string   `json:"format,omitempty"`
+	Repository      string   `json:"repository,omitempty"`
+	ContentSelector string   `json:"contentSelector,omitempty"`
+	ScriptName      string   `json:"scriptName,omitempty"`
+	Pattern         string   `json:"pattern,omitempty"`
+	Actions         []string `json:"actions,omitempty"`
+}
+
+type Repository struct {
+	Name    string             `json:"name"`
+	Format  string             `json:"format"`
+	Type    string             `json:"type"`
+	URL     string             `json:"url"`
+	Online  *bool              `json:"online,omitempty"`
+	Storage *RepositoryStorage `json:"storage,omitempty"`
+}
+
+type RepositoryStorage struct {
+	BlobStoreName string `json:"blobStoreName"`
+}
+
+// LDAPServer is the connection and mapping configuration of an LDAP server.
+// Only the fields describing how LDAP groups are mapped to Nexus roles are decoded.
+type LDAPServer struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Protocol          string `json:"protocol"`
+	Host              string `json:"host"`
+	Port              int    `json:"port"`
+	SearchBase        string `json:"searchBase"`
+	LDAPGroupsAsRoles bool   `json:"ldapGroupsAsRoles"`
+	GroupType         string `json:"groupType"`
+	GroupBaseDn       string `json:"groupBaseDn"`
 }
 
 type UserCreatePayload struct {
@@ -26,3 +77,32 @@ type UserCreatePayload struct {
 	Status       string   `json:"status"`
 	Roles        []string `json:"roles"`
 }
+
+// RolePayload is the body of requests creating or updating a role. The source and read-only flag are set by Nexus.
+type RolePayload struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Privileges  []string `json:"privileges"`
+	Roles       []string `json:"roles"`
+}
+
+// PrivilegePayload is the body of requests creating a privilege of a given type.
+// Only the fields of that type are sent, the type itself is part of the endpoint.
+type PrivilegePayload struct {
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	Format          string   `json:"format,omitempty"`
+	Repository      string   `json:"repository,omitempty"`
+	ContentSelector string   `json:"contentSelector,omitempty"`
+	Pattern         string   `json:"pattern,omitempty"`
+	Actions         []string `json:"actions,omitempty"`
+}
+
+// ContentSelector restricts repository-content-selector privileges to the content matched by a CSEL expression.
+type ContentSelector struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Expression  string `json:"expression"`
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotTTL bounds how long a listing is shared between resource syncers before it is fetched again.
+const snapshotTTL = 5 * time.Minute
+
+// snapshot holds a listing shared by every resource syncer, so that a sync requests each
+// listing from Nexus a constant number of times instead of once per resource.
+type snapshot[T any] struct {
+	mu        sync.Mutex
+	value     T
+	fetchedAt time.Time
+}
+
+func (s *snapshot[T]) get(ctx context.Context, fetch func(ctx context.Context) (T, error)) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < snapshotTTL {
+		return s.value, nil
+	}
+
+	value, err := fetch(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	s.value = value
+	s.fetchedAt = time.Now()
+	return value, nil
+}
+
+func (s *snapshot[T]) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zero T
+	s.value = zero
+	s.fetchedAt = time.Time{}
+}
+
+// UserSourcesSnapshot returns the shared listing of all user sources. The result must not be modified.
+func (c *APIClient) UserSourcesSnapshot(ctx context.Context) ([]UserSource, error) {
+	return c.userSources.get(ctx, func(ctx context.Context) ([]UserSource, error) {
+		sources, _, err := c.ListUserSources(ctx)
+		return sources, err
+	})
+}
+
+// UsersSnapshot returns the shared listing of the users of every user source. The result must not be modified.
+func (c *APIClient) UsersSnapshot(ctx context.Context) ([]*User, error) {
+	return c.users.get(ctx, c.ListAllUsers)
+}
+
+// RolesSnapshot returns the shared listing of all roles. The result must not be modified.
+func (c *APIClient) RolesSnapshot(ctx context.Context) ([]Role, error) {
+	return c.roles.get(ctx, func(ctx context.Context) ([]Role, error) {
+		roles, _, err := c.ListRoles(ctx)
+		return roles, err
+	})
+}
+
+// PrivilegesSnapshot returns the shared listing of all privileges. The result must not be modified.
+func (c *APIClient) PrivilegesSnapshot(ctx context.Context) ([]Privilege, error) {
+	return c.privileges.get(ctx, func(ctx context.Context) ([]Privilege, error) {
+		privileges, _, err := c.ListPrivileges(ctx)
+		return privileges, err
+	})
+}
+
+// LDAPServersSnapshot returns the shared listing of all LDAP servers. The result must not be modified.
+// An account that is not allowed to read the LDAP configuration gets an empty listing, so that
+// syncs keep working without LDAP groups instead of failing or asking again for every resource.
+func (c *APIClient) LDAPServersSnapshot(ctx context.Context) ([]LDAPServer, error) {
+	return c.ldapServers.get(ctx, func(ctx context.Context) ([]LDAPServer, error) {
+		servers, _, err := c.ListLDAPServers(ctx)
+		switch status.Code(err) {
+		case codes.PermissionDenied, codes.NotFound:
+			ctxzap.Extract(ctx).Warn(
+				"cannot read the LDAP configuration, LDAP groups are not synced, assign the account a role with the nx-ldap-read privilege",
+				zap.Error(err),
+			)
+			return nil, nil
+		}
+		return servers, err
+	})
+}
+
+// invalidateSnapshots drops all shared listings, so that reads following a write observe the change.
+func (c *APIClient) invalidateSnapshots() {
+	c.userSources.invalidate()
+	c.users.invalidate()
+	c.roles.invalidate()
+	c.privileges.invalidate()
+	c.ldapServers.invalidate()
+}
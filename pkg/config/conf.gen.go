@@ -7,6 +7,13 @@ type SonatypeNexus struct {
 	Host string `mapstructure:"host"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	DefaultRoles []string `mapstructure:"default-roles"`
+	PasswordMinLength int `mapstructure:"password-min-length"`
+	PasswordCharacterClasses []string `mapstructure:"password-character-classes"`
+	ServiceAccountPatterns []string `mapstructure:"service-account-patterns"`
+	DeleteMode string `mapstructure:"delete-mode"`
+	StrippedUserRole string `mapstructure:"stripped-user-role"`
+	ProtectedUserIds []string `mapstructure:"protected-user-ids"`
 }
 
 func (c* SonatypeNexus) findFieldByTag(tagValue string) (any, bool) {
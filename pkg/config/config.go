@@ -23,7 +23,54 @@ var (
 		field.WithIsSecret(true),
 		field.WithDisplayName("Password"),
 	)
-	ConfigurationFields = []field.SchemaField{HostField, UsernameField, PasswordField}
+	DefaultRolesField = field.StringSliceField("default-roles",
+		field.WithDescription("Roles assigned to new users when no roles are requested at account creation"),
+		field.WithDefaultValue([]string{"nx-anonymous"}),
+		field.WithDisplayName("Default roles"),
+	)
+	PasswordMinLengthField = field.IntField("password-min-length",
+		field.WithDescription("Minimum length of generated passwords, requests for shorter passwords are raised to it"),
+		field.WithDefaultValue(12),
+		field.WithDisplayName("Password minimum length"),
+	)
+	PasswordCharacterClassesField = field.StringSliceField("password-character-classes",
+		field.WithDescription("Character classes every generated password must contain: upper, lower, digit and symbol"),
+		field.WithDefaultValue([]string{"upper", "lower", "digit", "symbol"}),
+		field.WithDisplayName("Password character classes"),
+	)
+	ServiceAccountPatternsField = field.StringSliceField("service-account-patterns",
+		field.WithDescription("Glob patterns matching the IDs of users that are service accounts, for example svc-*"),
+		field.WithDisplayName("Service account patterns"),
+	)
+	DeleteModeField = field.StringField("delete-mode",
+		field.WithDescription("How users are deprovisioned: delete removes the user, disable only disables it, disable-and-strip-roles also replaces its roles with the stripped user role"),
+		field.WithDefaultValue("delete"),
+		field.WithString(func(r *field.StringRuler) {
+			r.In([]string{"delete", "disable", "disable-and-strip-roles"})
+		}),
+		field.WithDisplayName("Delete mode"),
+	)
+	StrippedUserRoleField = field.StringField("stripped-user-role",
+		field.WithDescription("Role left on users deprovisioned with disable-and-strip-roles, as Nexus requires local users to keep at least one role"),
+		field.WithDefaultValue("nx-anonymous"),
+		field.WithDisplayName("Stripped user role"),
+	)
+	ProtectedUserIDsField = field.StringSliceField("protected-user-ids",
+		field.WithDescription("IDs of users that are never deleted, disabled or stripped of roles, in addition to admin and anonymous"),
+		field.WithDisplayName("Protected user IDs"),
+	)
+	ConfigurationFields = []field.SchemaField{
+		HostField,
+		UsernameField,
+		PasswordField,
+		DefaultRolesField,
+		PasswordMinLengthField,
+		PasswordCharacterClassesField,
+		ServiceAccountPatternsField,
+		DeleteModeField,
+		StrippedUserRoleField,
+		ProtectedUserIDsField,
+	}
 
 	// FieldRelationships defines relationships between the ConfigurationFields that can be automatically validated.
 	// For example, a username and password can be required together, or an access token can be
@@ -0,0 +1,131 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	disableUserAction = "disable_user"
+	enableUserAction  = "enable_user"
+
+	// anonymousUserID is the built-in account Nexus uses for unauthenticated requests.
+	anonymousUserID = "anonymous"
+)
+
+// userIDArgument is the argument of the user actions holding the ID of the local Nexus user.
+var userIDArgument = &config.Field{
+	Name:        "user_id",
+	DisplayName: "User ID",
+	Description: "The ID of the local Nexus user",
+	IsRequired:  true,
+	Field:       &config.Field_StringField{StringField: &config.StringField{}},
+}
+
+// userActionReturnTypes describe the response of the user actions.
+var userActionReturnTypes = []*config.Field{
+	{
+		Name:        "status",
+		DisplayName: "Status",
+		Description: "The status of the user after the action",
+		Field:       &config.Field_StringField{StringField: &config.StringField{}},
+	},
+	{
+		Name:        "changed",
+		DisplayName: "Changed",
+		Description: "Whether the action changed the status of the user",
+		Field:       &config.Field_BoolField{BoolField: &config.BoolField{}},
+	},
+}
+
+var actionSchemas = map[string]*v2.BatonActionSchema{
+	disableUserAction: {
+		Name:        disableUserAction,
+		DisplayName: "Disable user",
+		Description: "Disable a local Nexus user so that it can no longer authenticate. Roles are kept.",
+		Arguments:   []*config.Field{userIDArgument},
+		ReturnTypes: userActionReturnTypes,
+	},
+	enableUserAction: {
+		Name:        enableUserAction,
+		DisplayName: "Enable user",
+		Description: "Enable a disabled local Nexus user. Roles are kept.",
+		Arguments:   []*config.Field{userIDArgument},
+		ReturnTypes: userActionReturnTypes,
+	},
+}
+
+// ListActionSchemas returns the schemas of the custom actions of the connector.
+func (d *Connector) ListActionSchemas(ctx context.Context) ([]*v2.BatonActionSchema, annotations.Annotations, error) {
+	return []*v2.BatonActionSchema{
+		actionSchemas[disableUserAction],
+		actionSchemas[enableUserAction],
+	}, nil, nil
+}
+
+// GetActionSchema returns the schema of the custom action with the given name.
+func (d *Connector) GetActionSchema(ctx context.Context, name string) (*v2.BatonActionSchema, annotations.Annotations, error) {
+	schema, ok := actionSchemas[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("baton-sonatype-nexus: unknown action %s", name)
+	}
+	return schema, nil, nil
+}
+
+// InvokeAction runs a custom action. Actions complete before returning, so no action ID is returned.
+func (d *Connector) InvokeAction(ctx context.Context, name string, args *structpb.Struct) (string, v2.BatonActionStatus, *structpb.Struct, annotations.Annotations, error) {
+	var status string
+	switch name {
+	case disableUserAction:
+		status = userStatusDisabled
+	case enableUserAction:
+		status = userStatusActive
+	default:
+		return "", v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, nil, nil, fmt.Errorf("baton-sonatype-nexus: unknown action %s", name)
+	}
+
+	userID := args.GetFields()[userIDArgument.GetName()].GetStringValue()
+	if userID == "" {
+		return "", v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, nil, nil, fmt.Errorf("baton-sonatype-nexus: %s requires a %s", name, userIDArgument.GetName())
+	}
+
+	if status == userStatusDisabled {
+		err := d.guard.checkUserRemoval(ctx, userID)
+		if err != nil {
+			return "", v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, nil, nil, err
+		}
+	}
+
+	user, changed, err := setUserStatus(ctx, d.client, userID, status)
+	if err != nil {
+		return "", v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, nil, nil, err
+	}
+
+	ctxzap.Extract(ctx).Info("baton-sonatype-nexus: user action completed",
+		zap.String("action", name),
+		zap.String("user_id", userID),
+		zap.Bool("changed", changed),
+	)
+
+	response, err := structpb.NewStruct(map[string]interface{}{
+		"status":  user.Status,
+		"changed": changed,
+	})
+	if err != nil {
+		return "", v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, nil, nil, err
+	}
+
+	return "", v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE, response, nil, nil
+}
+
+// GetActionStatus always fails, as every action completes when it is invoked.
+func (d *Connector) GetActionStatus(ctx context.Context, id string) (v2.BatonActionStatus, string, *structpb.Struct, annotations.Annotations, error) {
+	return v2.BatonActionStatus_BATON_ACTION_STATUS_UNKNOWN, "", nil, nil, fmt.Errorf("baton-sonatype-nexus: unknown action %s, actions complete when they are invoked", id)
+}
@@ -2,23 +2,60 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"path"
+	"slices"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Connector struct {
-	client *client.APIClient
+	client         *client.APIClient
+	username       string
+	opts           Options
+	passwordPolicy *passwordPolicy
+	guard          *safeguard
+}
+
+// Options holds the provisioning settings of the connector.
+type Options struct {
+	// DefaultRoles are assigned to new accounts when no roles are requested at creation.
+	DefaultRoles []string
+	// PasswordMinLength is the shortest password generated for new accounts and rotations.
+	PasswordMinLength int64
+	// PasswordCharacterClasses are the character classes every generated password must contain.
+	PasswordCharacterClasses []string
+	// ServiceAccountPatterns are glob patterns matching the IDs of users synced as service accounts.
+	ServiceAccountPatterns []string
+	// DeleteMode is how users are deprovisioned, one of delete, disable or disable-and-strip-roles.
+	// Users are deleted when it is empty.
+	DeleteMode string
+	// StrippedUserRole is the only role left on users deprovisioned with disable-and-strip-roles,
+	// since Nexus rejects local users without roles.
+	StrippedUserRole string
+	// ProtectedUserIDs are users that are never deleted, disabled or stripped of roles by the connector,
+	// in addition to the built-in admin and anonymous users.
+	ProtectedUserIDs []string
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
 	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(d.client),
-		newRoleBuilder(d.client),
+		newUserSourceBuilder(d.client),
+		newUserBuilder(d.client, d.opts, d.passwordPolicy, d.guard),
+		newGroupBuilder(d.client),
+		newRoleBuilder(d.client, d.guard),
+		newPrivilegeBuilder(d.client, d.guard),
+		newRepositoryBuilder(d.client),
+		newContentSelectorBuilder(d.client),
 	}
 }
 
@@ -85,24 +122,136 @@ func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 					Placeholder: "Active",
 					Order:       5,
 				},
+				"roles": {
+					DisplayName: "Roles",
+					Required:    false,
+					Description: "IDs of the roles assigned to the user. When empty, the connector's default roles are assigned",
+					Field: &v2.ConnectorAccountCreationSchema_Field_StringListField{
+						StringListField: &v2.ConnectorAccountCreationSchema_StringListField{},
+					},
+					Placeholder: "nx-anonymous",
+					Order:       6,
+				},
 			},
 		},
 	}, nil
 }
 
-// Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
-// to be sure that they are valid.
+// Validate is called to ensure that the connector is properly configured. It checks that Nexus is reachable,
+// that the credentials are valid and that the account can read everything a sync needs.
+// Whether the account can also provision users is reported separately, since it is only needed for provisioning.
 func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	_, err := d.client.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("baton-sonatype-nexus: Nexus is not reachable or not ready, check the host URL: %w", err)
+	}
+
+	users, _, err := d.client.ListUsersByID(ctx, d.username)
+	if err != nil {
+		return nil, validationError(err, "read users", "nx-users-read")
+	}
+
+	var currentUser *client.User
+	for _, u := range users {
+		if u.UserID == d.username {
+			currentUser = u
+			break
+		}
+	}
+	if currentUser == nil {
+		return nil, fmt.Errorf("baton-sonatype-nexus: account %s was not found in Nexus, check the username", d.username)
+	}
+
+	_, _, err = d.client.ListUserSources(ctx)
+	if err != nil {
+		return nil, validationError(err, "read user sources", "nx-users-read")
+	}
+
+	roles, _, err := d.client.ListRoles(ctx)
+	if err != nil {
+		return nil, validationError(err, "read roles", "nx-roles-read")
+	}
+
+	privileges, _, err := d.client.ListPrivileges(ctx)
+	if err != nil {
+		return nil, validationError(err, "read privileges", "nx-privileges-read")
+	}
+
+	_, _, err = d.client.ListRepositories(ctx)
+	if err != nil {
+		return nil, validationError(err, "read repositories", "nx-repository-view-*-*-browse")
+	}
+
+	evaluator := newPrivilegeEvaluator(privileges)
+	granted := effectivePrivileges(roles, append(slices.Clone(currentUser.Roles), currentUser.ExternalRoles...))
+
+	var missing []string
+	for _, action := range []string{"create", "update", "delete"} {
+		if !evaluator.impliesAny(granted, "nexus", "users", action) {
+			missing = append(missing, fmt.Sprintf("nx-users-%s", action))
+		}
+	}
+
+	if len(missing) > 0 {
+		l.Warn(
+			"baton-sonatype-nexus: account cannot provision users, assign it a role with the missing privileges to enable provisioning",
+			zap.String("username", d.username),
+			zap.Strings("missing_privileges", missing),
+		)
+	} else {
+		l.Info("baton-sonatype-nexus: account can provision users", zap.String("username", d.username))
+	}
+
 	return nil, nil
 }
 
+// validationError turns a failed validation request into an actionable error.
+func validationError(err error, action, privilege string) error {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return fmt.Errorf("baton-sonatype-nexus: invalid credentials, check the username and password: %w", err)
+	case codes.PermissionDenied:
+		return fmt.Errorf("baton-sonatype-nexus: account is not allowed to %s, assign it a role with the %s privilege: %w", action, privilege, err)
+	}
+
+	return fmt.Errorf("baton-sonatype-nexus: failed to %s: %w", action, err)
+}
+
 // New returns a new instance of the connector.
-func New(ctx context.Context, baseURL, username, password string) (*Connector, error) {
+func New(ctx context.Context, baseURL, username, password string, opts Options) (*Connector, error) {
+	policy, err := newPasswordPolicy(opts.PasswordMinLength, opts.PasswordCharacterClasses)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.DeleteMode {
+	case "", deleteModeDelete, deleteModeDisable, deleteModeDisableAndStripRoles:
+	default:
+		return nil, fmt.Errorf("baton-sonatype-nexus: invalid delete mode %q, expected one of %s, %s or %s",
+			opts.DeleteMode, deleteModeDelete, deleteModeDisable, deleteModeDisableAndStripRoles)
+	}
+
+	if opts.DeleteMode == deleteModeDisableAndStripRoles && opts.StrippedUserRole == "" {
+		return nil, fmt.Errorf("baton-sonatype-nexus: delete mode %s requires a stripped user role, as Nexus requires local users to keep at least one role", deleteModeDisableAndStripRoles)
+	}
+
+	for _, pattern := range opts.ServiceAccountPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("baton-sonatype-nexus: invalid service account pattern %q: %w", pattern, err)
+		}
+	}
+
 	c, err := client.NewClient(ctx, baseURL, username, password, nil)
 	if err != nil {
 		return nil, err
 	}
 	return &Connector{
-		client: c,
+		client:         c,
+		username:       username,
+		opts:           opts,
+		passwordPolicy: policy,
+		guard:          newSafeguard(c, username, opts.ProtectedUserIDs),
 	}, nil
 }
@@ -2,14 +2,28 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
 	"github.com/conductorone/baton-sonatype-nexus/pkg/test"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Tests that the client can fetch users.
@@ -195,8 +209,106 @@ func TestNexusClient_GetRoles(t *testing.T) {
 }
 
 func TestUserBuilder_List(t *testing.T) {
-	// Test the user builder List method.
-	body, err := test.ReadFile("usersMock.json")
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	fake.Users = []*client.User{
+		{UserID: "admin", FirstName: "Administrator", LastName: "User", Source: "default", Status: "active"},
+		{UserID: "anonymous", FirstName: "Anonymous", LastName: "User", Source: "default", Status: "active"},
+		{UserID: "jdoe", FirstName: "John", LastName: "Doe", Source: "LDAP", Status: "active"},
+	}
+
+	ctx := context.Background()
+	c := fake.Client(t)
+
+	sources, _, _, err := newUserSourceBuilder(c).List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 user sources, got %d", len(sources))
+	}
+
+	userBuilder := newUserBuilder(c, Options{}, testPasswordPolicy(t), newSafeguard(c, "admin", nil))
+
+	expected := map[string][]string{
+		"default": {"admin", "anonymous"},
+		"LDAP":    {"LDAP/jdoe"},
+	}
+	for _, source := range sources {
+		sourceAnnos := annotations.Annotations(source.Annotations)
+		if !sourceAnnos.Contains(&v2.ChildResourceType{}) {
+			t.Errorf("Expected user source %s to have users as children", source.Id.Resource)
+		}
+
+		resources, _, _, err := userBuilder.List(ctx, source.Id, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var userIDs []string
+		for _, r := range resources {
+			if r.DisplayName == "" {
+				t.Error("Expected resource display name to be set")
+			}
+			if r.ParentResourceId.GetResource() != source.Id.Resource {
+				t.Errorf("Expected user %s to be a child of %s, got %v", r.Id.Resource, source.Id.Resource, r.ParentResourceId)
+			}
+			userIDs = append(userIDs, r.Id.Resource)
+		}
+
+		if !reflect.DeepEqual(userIDs, expected[source.Id.Resource]) {
+			t.Errorf("Expected users %v for source %s, got %v", expected[source.Id.Resource], source.Id.Resource, userIDs)
+		}
+	}
+
+	resources, _, _, err := userBuilder.List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resources) != 0 {
+		t.Errorf("Expected no users without a parent user source, got %d", len(resources))
+	}
+}
+
+func TestUserBuilder_StatusAndAccountType(t *testing.T) {
+	userBuilder := newUserBuilder(nil, Options{ServiceAccountPatterns: []string{"svc-*", "ci"}}, nil, nil)
+
+	for _, tc := range []struct {
+		user        client.User
+		status      v2.UserTrait_Status_Status
+		details     string
+		accountType v2.UserTrait_AccountType
+	}{
+		{client.User{UserID: "admin", Status: "active"}, v2.UserTrait_Status_STATUS_ENABLED, "", v2.UserTrait_ACCOUNT_TYPE_SYSTEM},
+		{client.User{UserID: "anonymous", Status: "disabled"}, v2.UserTrait_Status_STATUS_DISABLED, "", v2.UserTrait_ACCOUNT_TYPE_SYSTEM},
+		{client.User{UserID: "svc-deploy", Status: "locked"}, v2.UserTrait_Status_STATUS_DISABLED, "locked", v2.UserTrait_ACCOUNT_TYPE_SERVICE},
+		{client.User{UserID: "ci", Status: "active"}, v2.UserTrait_Status_STATUS_ENABLED, "", v2.UserTrait_ACCOUNT_TYPE_SERVICE},
+		{client.User{UserID: "jdoe", Status: "changepassword"}, v2.UserTrait_Status_STATUS_ENABLED, "changepassword", v2.UserTrait_ACCOUNT_TYPE_HUMAN},
+	} {
+		userResource, err := userBuilder.userToResource(&tc.user)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		userTrait, err := resource.GetUserTrait(userResource)
+		if err != nil {
+			t.Fatalf("Expected a user trait, got %v", err)
+		}
+
+		if userTrait.GetStatus().GetStatus() != tc.status || userTrait.GetStatus().GetDetails() != tc.details {
+			t.Errorf("Expected status %v (%q) for %s, got %v", tc.status, tc.details, tc.user.UserID, userTrait.GetStatus())
+		}
+		if userTrait.GetAccountType() != tc.accountType {
+			t.Errorf("Expected account type %v for %s, got %v", tc.accountType, tc.user.UserID, userTrait.GetAccountType())
+		}
+	}
+}
+
+func TestNexusClient_GetPrivileges(t *testing.T) {
+	body, err := test.ReadFile("privilegesMock.json")
 	if err != nil {
 		t.Fatalf("Error reading body: %s", err)
 	}
@@ -208,34 +320,1986 @@ func TestUserBuilder_List(t *testing.T) {
 	mockResponse.Header.Set("Content-Type", "application/json")
 
 	testClient := test.NewTestClient(mockResponse, nil)
-	userBuilder := newUserBuilder(testClient)
 
 	ctx := context.Background()
-	resources, _, _, err := userBuilder.List(ctx, nil, nil)
 
+	result, _, err := testClient.ListPrivileges(ctx)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if resources == nil {
-		t.Fatal("Expected non-nil resources")
+	expectedCount := len(test.Privileges)
+	if len(result) != expectedCount {
+		t.Fatalf("Expected count to be %d, got %d", expectedCount, len(result))
 	}
 
-	expectedCount := len(test.Users)
+	for index, privilege := range result {
+		expected := test.Privileges[index]
+		if privilege.Type != expected["type"] ||
+			privilege.Name != expected["name"] ||
+			privilege.Description != expected["description"] {
+			t.Errorf("Unexpected privilege: got %+v, want %+v", privilege, expected)
+		}
+		if format, ok := expected["format"]; ok && privilege.Format != format {
+			t.Errorf("Expected format %s, got %s", format, privilege.Format)
+		}
+		if pattern, ok := expected["pattern"]; ok && privilege.Pattern != pattern {
+			t.Errorf("Expected pattern %s, got %s", pattern, privilege.Pattern)
+		}
+	}
+
+	resources, _, _, err := newPrivilegeBuilder(test.NewTestClient(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     mockResponse.Header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil), nil).List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 	if len(resources) != expectedCount {
-		t.Errorf("Expected count to be %d, got %d", expectedCount, len(resources))
+		t.Errorf("Expected %d privilege resources, got %d", expectedCount, len(resources))
+	}
+}
+
+func TestPrivilegeBuilder_Grants(t *testing.T) {
+	body, err := test.ReadFile("rolesMock.json")
+	if err != nil {
+		t.Fatalf("Error reading body: %s", err)
+	}
+	mockResponse := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	mockResponse.Header.Set("Content-Type", "application/json")
+
+	privilegeBuilder := newPrivilegeBuilder(test.NewTestClient(mockResponse, nil), nil)
+
+	ctx := context.Background()
+	privilegeResource, err := privilegeToResource(client.Privilege{Name: "nx-all", Type: "application"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	grants, _, _, err := privilegeBuilder.Grants(ctx, privilegeResource, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(grants) != 1 {
+		t.Fatalf("Expected 1 grant, got %d", len(grants))
+	}
+
+	g := grants[0]
+	if g.Principal.Id.ResourceType != roleResourceType.Id || g.Principal.Id.Resource != "nx-admin" {
+		t.Errorf("Expected grant to role nx-admin, got %s/%s", g.Principal.Id.ResourceType, g.Principal.Id.Resource)
+	}
+
+	expandable := &v2.GrantExpandable{}
+	annos := annotations.Annotations(g.Annotations)
+	ok, err := annos.Pick(expandable)
+	if err != nil || !ok {
+		t.Fatalf("Expected grant to be expandable, got %v", err)
+	}
+	if !reflect.DeepEqual(expandable.EntitlementIds, []string{"role:nx-admin:assigned"}) {
+		t.Errorf("Unexpected expandable entitlements: %v", expandable.EntitlementIds)
+	}
+}
+
+func TestNestedRoleGraph_IgnoresCycles(t *testing.T) {
+	roles := []client.Role{
+		{ID: "team-lead", Roles: []string{"developer"}},
+		{ID: "developer", Roles: []string{"deployer"}},
+		{ID: "deployer", Roles: []string{"team-lead"}},
+		{ID: "self", Roles: []string{"self"}},
+	}
+
+	graph, cycles := nestedRoleGraph(roles)
+
+	// Roles are visited in sorted order, so the deployer -> team-lead -> developer chain is kept
+	// and the developer -> deployer nesting that closes the loop is dropped.
+	expected := map[string][]string{
+		"deployer":  {"team-lead"},
+		"team-lead": {"developer"},
+	}
+	if !reflect.DeepEqual(graph, expected) {
+		t.Errorf("Unexpected nested role graph: got %v, want %v", graph, expected)
+	}
+
+	expectedCycles := []roleNesting{
+		{roleID: "developer", nestedRoleID: "deployer"},
+		{roleID: "self", nestedRoleID: "self"},
+	}
+	if !reflect.DeepEqual(cycles, expectedCycles) {
+		t.Errorf("Unexpected cycles: got %v, want %v", cycles, expectedCycles)
+	}
+}
+
+func TestRoleBuilder_Grants(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "default", Roles: []string{"nx-deployer"}},
+		{UserID: "asmith", Source: "default", Roles: []string{"team-lead"}},
+	}
+	fake.Roles = []client.Role{
+		{ID: "team-lead", Name: "Team Lead", Source: "default", Roles: []string{"nx-deployer"}},
+		{ID: "nx-deployer", Name: "Deployer", Source: "default"},
+	}
+
+	roleBuilder := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+	roleResource := &v2.Resource{Id: roleResourceID("nx-deployer"), DisplayName: "Deployer"}
+	grants, _, _, err := roleBuilder.Grants(context.Background(), roleResource, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(grants) != 2 {
+		t.Fatalf("Expected 2 grants, got %d", len(grants))
+	}
+
+	if grants[0].Principal.Id.ResourceType != userResourceType.Id || grants[0].Principal.Id.Resource != "jdoe" {
+		t.Errorf("Expected grant to user jdoe, got %v", grants[0].Principal.Id)
+	}
+
+	if grants[1].Principal.Id.ResourceType != roleResourceType.Id || grants[1].Principal.Id.Resource != "team-lead" {
+		t.Errorf("Expected grant to role team-lead, got %v", grants[1].Principal.Id)
+	}
+	nestedAnnos := annotations.Annotations(grants[1].Annotations)
+	if !nestedAnnos.Contains(&v2.GrantExpandable{}) {
+		t.Error("Expected nested role grant to be expandable")
+	}
+
+	for _, g := range grants {
+		if g.Entitlement.Id != "role:nx-deployer:assigned" {
+			t.Errorf("Unexpected entitlement %s", g.Entitlement.Id)
+		}
+	}
+}
+
+func TestRoleBuilder_ExternalRoles(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "LDAP", Roles: []string{"nx-anonymous"}, ExternalRoles: []string{"developers"}},
+	}
+	fake.Roles = []client.Role{
+		{ID: "developers", Name: "developers", Source: "default"},
+	}
+
+	ctx := context.Background()
+	roleBuilder := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+	roleResource := &v2.Resource{Id: roleResourceID("developers"), DisplayName: "developers"}
+	grants, _, _, err := roleBuilder.Grants(ctx, roleResource, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(grants) != 1 || grants[0].Principal.Id.Resource != "LDAP/jdoe" {
+		t.Fatalf("Expected a grant to LDAP/jdoe, got %v", grants)
+	}
+
+	grantAnnos := annotations.Annotations(grants[0].Annotations)
+	immutable := &v2.GrantImmutable{}
+	if ok, err := grantAnnos.Pick(immutable); err != nil || !ok {
+		t.Fatalf("Expected the external role grant to be immutable, got %v", err)
+	}
+	if immutable.SourceId != "LDAP" {
+		t.Errorf("Expected the grant to be managed by LDAP, got %q", immutable.SourceId)
+	}
+
+	_, err = roleBuilder.Revoke(ctx, grants[0])
+	if err == nil || !strings.Contains(err.Error(), "managed in LDAP/SAML") {
+		t.Fatalf("Expected the revoke to be refused, got %v", err)
+	}
+	if fake.Requests(http.MethodPut, "/service/rest/v1/security/users/jdoe") != 0 {
+		t.Error("Expected no update of the user")
+	}
+}
+
+func TestRoleBuilder_GrantRevoke_Sources(t *testing.T) {
+	for _, tc := range []struct {
+		source        string
+		externalRoles []string
+	}{
+		{source: "default"},
+		{source: "LDAP", externalRoles: []string{"developers"}},
+		{source: "Crowd", externalRoles: []string{"jira-users"}},
+	} {
+		t.Run(tc.source, func(t *testing.T) {
+			fake := test.NewFakeNexus(t)
+			fake.Users = []*client.User{
+				{UserID: "jdoe", FirstName: "John", LastName: "Doe", Source: tc.source, Status: "active", Roles: []string{"nx-anonymous"}, ExternalRoles: tc.externalRoles},
+			}
+			if tc.source != "default" {
+				// A local user with the same ID must not be touched.
+				fake.Users = append(fake.Users, &client.User{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}})
+			}
+
+			ctx := context.Background()
+			roleBuilder := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+			principal := &v2.Resource{
+				Id:               &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"},
+				ParentResourceId: &v2.ResourceId{ResourceType: userSourceResourceType.Id, Resource: tc.source},
+			}
+			deployers := &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID("nx-deployer")}}
+
+			_, err := roleBuilder.Grant(ctx, principal, deployers)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			user := fake.Users[0]
+			if !reflect.DeepEqual(user.Roles, []string{"nx-anonymous", "nx-deployer"}) {
+				t.Errorf("Expected the role to be added to the Nexus-side roles, got %v", user.Roles)
+			}
+			if !reflect.DeepEqual(user.ExternalRoles, tc.externalRoles) {
+				t.Errorf("Expected the directory roles to be unchanged, got %v", user.ExternalRoles)
+			}
+			if user.Source != tc.source {
+				t.Errorf("Expected the user to stay in source %s, got %s", tc.source, user.Source)
+			}
+			if len(fake.Users) > 1 && !reflect.DeepEqual(fake.Users[1].Roles, []string{"nx-anonymous"}) {
+				t.Errorf("Expected the local user to be unchanged, got %v", fake.Users[1].Roles)
+			}
+
+			annos, err := roleBuilder.Grant(ctx, principal, deployers)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !annos.Contains(&v2.GrantAlreadyExists{}) {
+				t.Error("Expected the second grant to report that it already exists")
+			}
+
+			_, err = roleBuilder.Revoke(ctx, &v2.Grant{Principal: principal, Entitlement: deployers})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			user = fake.Users[0]
+			if !reflect.DeepEqual(user.Roles, []string{"nx-anonymous"}) {
+				t.Errorf("Expected the role to be removed, got %v", user.Roles)
+			}
+			if !reflect.DeepEqual(user.ExternalRoles, tc.externalRoles) {
+				t.Errorf("Expected the directory roles to be unchanged, got %v", user.ExternalRoles)
+			}
+		})
+	}
+}
+
+func TestRoleBuilder_CreateDelete(t *testing.T) {
+	ctx := context.Background()
+
+	newFake := func(t *testing.T) *test.FakeNexus {
+		fake := test.NewFakeNexus(t)
+		fake.Roles = []client.Role{
+			{ID: "nx-admin", Name: "nx-admin", Source: "default", ReadOnly: true, Privileges: []string{"nx-all"}},
+			{ID: "developers", Name: "Developers", Source: "default", Privileges: []string{"nx-repository-view-*-*-read"}},
+			{ID: "ldap-devs", Name: "ldap-devs", Source: "LDAP"},
+		}
+		fake.Privileges = []client.Privilege{
+			{Name: "nx-all", Type: "wildcard", Pattern: "nexus:*"},
+			{Name: "nx-repository-view-*-*-read", Type: "repository-view", Format: "*", Repository: "*", Actions: []string{"READ"}},
+			{Name: "nx-repository-view-*-*-edit", Type: "repository-view", Format: "*", Repository: "*", Actions: []string{"EDIT"}},
+		}
+		return fake
+	}
+
+	roleResource := func(t *testing.T, profile map[string]interface{}) *v2.Resource {
+		res, err := resource.NewRoleResource("", roleResourceType, "", []resource.RoleTraitOption{resource.WithRoleProfile(profile)})
+		if err != nil {
+			t.Fatalf("Failed to create role resource: %v", err)
+		}
+		return res
+	}
+
+	t.Run("create", func(t *testing.T) {
+		fake := newFake(t)
+		r := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+		created, _, err := r.Create(ctx, roleResource(t, map[string]interface{}{
+			"role_id":     "release-managers",
+			"name":        "Release managers",
+			"description": "Can release artifacts",
+			"privileges":  []interface{}{"nx-repository-view-*-*-edit"},
+			"roles":       []interface{}{"developers"},
+		}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if created.Id.Resource != "release-managers" || created.DisplayName != "Release managers" {
+			t.Errorf("Expected the created role to be returned, got %v", created)
+		}
+
+		role := fake.Role("release-managers")
+		if role == nil {
+			t.Fatal("Expected the role to be created")
+		}
+		if !reflect.DeepEqual(role.Privileges, []string{"nx-repository-view-*-*-edit"}) || !reflect.DeepEqual(role.Roles, []string{"developers"}) {
+			t.Errorf("Expected the privileges and nested roles to be set, got %v and %v", role.Privileges, role.Roles)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		fake := newFake(t)
+		r := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+		_, _, err := r.Create(ctx, roleResource(t, map[string]interface{}{
+			"role_id":          "developers",
+			"name":             "Developers",
+			"privileges":       "nx-repository-view-*-*-read, nx-repository-view-*-*-edit",
+			"roles":            []interface{}{},
+			"replace_existing": true,
+		}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		role := fake.Role("developers")
+		if !reflect.DeepEqual(role.Privileges, []string{"nx-repository-view-*-*-read", "nx-repository-view-*-*-edit"}) {
+			t.Errorf("Expected the privileges to be replaced, got %v", role.Privileges)
+		}
+		if fake.Requests(http.MethodPost, "/service/rest/v1/security/roles") != 0 {
+			t.Error("Expected the existing role to be updated instead of created")
+		}
+	})
+
+	for name, profile := range map[string]map[string]interface{}{
+		"read-only role":      {"role_id": "nx-admin", "privileges": []interface{}{"nx-all"}, "roles": []interface{}{}, "replace_existing": true},
+		"LDAP role":           {"role_id": "ldap-devs", "privileges": []interface{}{}, "roles": []interface{}{}, "replace_existing": true},
+		"existing role":       {"role_id": "developers", "privileges": []interface{}{"nx-repository-view-*-*-edit"}, "roles": []interface{}{}},
+		"partial replacement": {"role_id": "developers", "privileges": []interface{}{"nx-repository-view-*-*-edit"}, "replace_existing": true},
+		"unknown privilege":   {"role_id": "testers", "privileges": []interface{}{"nx-unknown"}},
+		"unknown role":        {"role_id": "testers", "roles": []interface{}{"qa"}},
+		"missing ID":          {"name": "Testers"},
+	} {
+		t.Run("refuse "+name, func(t *testing.T) {
+			fake := newFake(t)
+			_, _, err := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil)).Create(ctx, roleResource(t, profile))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			roleID, _ := profile["role_id"].(string)
+			if fake.Requests(http.MethodPost, "/service/rest/v1/security/roles")+fake.Requests(http.MethodPut, "/service/rest/v1/security/roles/"+roleID) != 0 {
+				t.Error("Expected no role to be written")
+			}
+		})
+	}
+
+	t.Run("refuse nesting a role into itself", func(t *testing.T) {
+		fake := newFake(t)
+		fake.Roles = append(fake.Roles, client.Role{ID: "leads", Name: "leads", Source: "default", Roles: []string{"developers"}})
+		_, _, err := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil)).Create(ctx, roleResource(t, map[string]interface{}{
+			"role_id": "developers",
+			"roles":   []interface{}{"leads"},
+		}))
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+	})
+
+	t.Run("existing role is reported", func(t *testing.T) {
+		fake := newFake(t)
+		_, _, err := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil)).Create(ctx, roleResource(t, map[string]interface{}{
+			"role_id": "developers",
+		}))
+		if status.Code(err) != codes.AlreadyExists {
+			t.Errorf("Expected an already exists error, got %v", err)
+		}
+	})
+
+	t.Run("refuse taking away the last admin", func(t *testing.T) {
+		fake := newFake(t)
+		fake.Roles = append(fake.Roles, client.Role{ID: "platform-admins", Name: "platform-admins", Source: "default", Roles: []string{"nx-admin"}})
+		fake.Users = []*client.User{
+			{UserID: "ops", Source: "default", Status: "active", Roles: []string{"platform-admins"}},
+		}
+		nexus := fake.Client(t)
+		r := newRoleBuilder(nexus, newSafeguard(nexus, "baton", nil))
+
+		_, _, err := r.Create(ctx, roleResource(t, map[string]interface{}{
+			"role_id":          "platform-admins",
+			"privileges":       []interface{}{},
+			"roles":            []interface{}{"developers"},
+			"replace_existing": true,
+		}))
+		if err == nil {
+			t.Error("Expected replacing the last admin role to be refused")
+		}
+
+		_, err = r.Delete(ctx, roleResourceID("platform-admins"))
+		if err == nil {
+			t.Error("Expected deleting the last admin role to be refused")
+		}
+
+		if role := fake.Role("platform-admins"); role == nil || !reflect.DeepEqual(role.Roles, []string{"nx-admin"}) {
+			t.Errorf("Expected the role to be kept, got %v", role)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		fake := newFake(t)
+		r := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+		_, err := r.Delete(ctx, roleResourceID("developers"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if fake.Role("developers") != nil {
+			t.Error("Expected the role to be deleted")
+		}
+
+		for _, roleID := range []string{"nx-admin", "ldap-devs", "unknown"} {
+			_, err := r.Delete(ctx, roleResourceID(roleID))
+			if err == nil {
+				t.Errorf("Expected deleting %s to be refused", roleID)
+			}
+		}
+		if fake.Role("nx-admin") == nil || fake.Role("ldap-devs") == nil {
+			t.Error("Expected the refused roles to be kept")
+		}
+	})
+}
+
+func TestPrivilegeBuilder_GrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	fake := test.NewFakeNexus(t)
+	fake.Roles = []client.Role{
+		{ID: "nx-admin", Name: "nx-admin", Source: "default", ReadOnly: true, Privileges: []string{"nx-all"}},
+		{ID: "developers", Name: "Developers", Source: "default", Privileges: []string{"nx-repository-view-*-*-read"}},
+		{ID: "ldap-devs", Name: "ldap-devs", Source: "LDAP"},
 	}
 
-	// Check that resources have the correct structure.
-	for _, resource := range resources {
-		if resource.Id == nil {
-			t.Error("Expected resource ID to be set")
+	p := newPrivilegeBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+	role := func(roleID string) *v2.Resource {
+		return &v2.Resource{Id: roleResourceID(roleID)}
+	}
+	privilege := func(name string) *v2.Entitlement {
+		return &v2.Entitlement{Resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: privilegeResourceType.Id, Resource: name}}}
+	}
+
+	t.Run("grant and revoke", func(t *testing.T) {
+		_, err := p.Grant(ctx, role("developers"), privilege("nx-repository-view-*-*-edit"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if privileges := fake.Role("developers").Privileges; !reflect.DeepEqual(privileges, []string{"nx-repository-view-*-*-read", "nx-repository-view-*-*-edit"}) {
+			t.Errorf("Expected the privilege to be added, got %v", privileges)
+		}
+
+		annos, err := p.Grant(ctx, role("developers"), privilege("nx-repository-view-*-*-edit"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !annos.Contains(&v2.GrantAlreadyExists{}) {
+			t.Error("Expected the second grant to report that it already exists")
+		}
+
+		_, err = p.Revoke(ctx, &v2.Grant{Principal: role("developers"), Entitlement: privilege("nx-repository-view-*-*-read")})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if privileges := fake.Role("developers").Privileges; !reflect.DeepEqual(privileges, []string{"nx-repository-view-*-*-edit"}) {
+			t.Errorf("Expected the privilege to be removed, got %v", privileges)
+		}
+
+		annos, err = p.Revoke(ctx, &v2.Grant{Principal: role("developers"), Entitlement: privilege("nx-repository-view-*-*-read")})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !annos.Contains(&v2.GrantAlreadyRevoked{}) {
+			t.Error("Expected the second revoke to report that it is already revoked")
+		}
+	})
+
+	t.Run("refused principals", func(t *testing.T) {
+		for _, principal := range []*v2.Resource{
+			role("nx-admin"),
+			role("ldap-devs"),
+			{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"}},
+		} {
+			_, err := p.Grant(ctx, principal, privilege("nx-repository-view-*-*-edit"))
+			if err == nil {
+				t.Errorf("Expected granting to %s to be refused", principal.Id.Resource)
+			}
+		}
+
+		_, err := p.Revoke(ctx, &v2.Grant{Principal: role("nx-admin"), Entitlement: privilege("nx-all")})
+		if err == nil {
+			t.Error("Expected revoking from nx-admin to be refused")
+		}
+		if privileges := fake.Role("nx-admin").Privileges; !reflect.DeepEqual(privileges, []string{"nx-all"}) {
+			t.Errorf("Expected nx-admin to be unchanged, got %v", privileges)
+		}
+	})
+
+	t.Run("refuse taking away the last admin", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Privileges = []client.Privilege{
+			{Name: "nx-all", Type: "wildcard", Pattern: "nexus:*"},
+		}
+		fake.Roles = []client.Role{
+			{ID: "superusers", Name: "superusers", Source: "default", Privileges: []string{"nx-all"}},
+		}
+		fake.Users = []*client.User{
+			{UserID: "ops", Source: "default", Status: "active", Roles: []string{"superusers"}},
+		}
+		p := newPrivilegeBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+
+		_, err := p.Revoke(ctx, &v2.Grant{Principal: role("superusers"), Entitlement: privilege("nx-all")})
+		if err == nil {
+			t.Fatal("Expected revoking nx-all from the last admin role to be refused")
+		}
+		if privileges := fake.Role("superusers").Privileges; !reflect.DeepEqual(privileges, []string{"nx-all"}) {
+			t.Errorf("Expected superusers to be unchanged, got %v", privileges)
+		}
+	})
+
+	t.Run("concurrent grants", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		expected := slices.Clone(fake.Role("developers").Privileges)
+		for i := range 5 {
+			name := fmt.Sprintf("privilege-%d", i)
+			expected = append(expected, name)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := p.Grant(ctx, role("developers"), privilege(name))
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if privileges := fake.Role("developers").Privileges; !sameIDs(privileges, expected) {
+			t.Errorf("Expected every granted privilege to be kept, got %v", privileges)
+		}
+	})
+
+	t.Run("overwritten update", func(t *testing.T) {
+		overwritten := false
+		fake.RoleUpdateHook = func(role *client.Role) {
+			if !overwritten {
+				overwritten = true
+				role.Privileges = slices.DeleteFunc(role.Privileges, func(p string) bool { return p == "nx-search-read" })
+			}
 		}
-		if resource.DisplayName == "" {
-			t.Error("Expected resource display name to be set")
+		t.Cleanup(func() { fake.RoleUpdateHook = nil })
+
+		_, err := p.Grant(ctx, role("developers"), privilege("nx-search-read"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
 		}
-		if resource.Id.ResourceType == "" {
-			t.Error("Expected resource type to be set")
+		if !slices.Contains(fake.Role("developers").Privileges, "nx-search-read") {
+			t.Error("Expected the overwritten grant to be retried")
 		}
+	})
+}
+
+func TestRoleBuilder_NestedRoles(t *testing.T) {
+	ctx := context.Background()
+	fake := test.NewFakeNexus(t)
+	fake.Roles = []client.Role{
+		{ID: "nx-admin", Name: "nx-admin", Source: "default", ReadOnly: true},
+		{ID: "platform-admins", Name: "platform-admins", Source: "default", Roles: []string{"nx-admin"}},
+		{ID: "developers", Name: "developers", Source: "default"},
+		{ID: "leads", Name: "leads", Source: "default", Roles: []string{"developers"}},
+		{ID: "managers", Name: "managers", Source: "default", Roles: []string{"leads"}},
+	}
+	fake.Users = []*client.User{
+		{UserID: "ops", Source: "default", Status: "active", Roles: []string{"platform-admins"}},
+	}
+
+	nexus := fake.Client(t)
+	r := newRoleBuilder(nexus, newSafeguard(nexus, "admin", nil))
+	role := func(roleID string) *v2.Resource {
+		return &v2.Resource{Id: roleResourceID(roleID)}
+	}
+	assigned := func(roleID string) *v2.Entitlement {
+		return &v2.Entitlement{Resource: role(roleID)}
 	}
+
+	t.Run("grant and revoke", func(t *testing.T) {
+		_, err := r.Grant(ctx, role("leads"), assigned("platform-admins"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if roles := fake.Role("leads").Roles; !reflect.DeepEqual(roles, []string{"developers", "platform-admins"}) {
+			t.Errorf("Expected the role to be nested, got %v", roles)
+		}
+
+		annos, err := r.Grant(ctx, role("leads"), assigned("platform-admins"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !annos.Contains(&v2.GrantAlreadyExists{}) {
+			t.Error("Expected the second grant to report that it already exists")
+		}
+
+		_, err = r.Revoke(ctx, &v2.Grant{Principal: role("leads"), Entitlement: assigned("platform-admins")})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if roles := fake.Role("leads").Roles; !reflect.DeepEqual(roles, []string{"developers"}) {
+			t.Errorf("Expected the nested role to be removed, got %v", roles)
+		}
+	})
+
+	t.Run("refuse cycles", func(t *testing.T) {
+		for _, tc := range []struct{ parent, nested string }{
+			{parent: "developers", nested: "developers"},
+			{parent: "developers", nested: "leads"},
+			{parent: "developers", nested: "managers"},
+		} {
+			_, err := r.Grant(ctx, role(tc.parent), assigned(tc.nested))
+			if err == nil {
+				t.Errorf("Expected nesting %s inside %s to be refused", tc.nested, tc.parent)
+			}
+		}
+		if roles := fake.Role("developers").Roles; len(roles) != 0 {
+			t.Errorf("Expected developers to be unchanged, got %v", roles)
+		}
+	})
+
+	t.Run("refuse read-only parent", func(t *testing.T) {
+		_, err := r.Grant(ctx, role("nx-admin"), assigned("developers"))
+		if err == nil {
+			t.Fatal("Expected nesting a role inside nx-admin to be refused")
+		}
+	})
+
+	t.Run("refuse removing the last admin", func(t *testing.T) {
+		_, err := r.Revoke(ctx, &v2.Grant{Principal: role("platform-admins"), Entitlement: assigned("nx-admin")})
+		if err == nil {
+			t.Fatal("Expected the revoke to be refused")
+		}
+		if roles := fake.Role("platform-admins").Roles; !reflect.DeepEqual(roles, []string{"nx-admin"}) {
+			t.Errorf("Expected platform-admins to be unchanged, got %v", roles)
+		}
+	})
+}
+
+func TestPrivilegeBuilder_CreateDelete(t *testing.T) {
+	ctx := context.Background()
+
+	newFake := func(t *testing.T) *test.FakeNexus {
+		fake := test.NewFakeNexus(t)
+		fake.Privileges = []client.Privilege{
+			{Name: "nx-all", Type: "wildcard", Pattern: "nexus:*", ReadOnly: true},
+			{Name: "team-a-releases-read", Type: "repository-view", Format: "maven2", Repository: "maven-releases", Actions: []string{"READ"}},
+		}
+		fake.Repositories = []client.Repository{
+			{Name: "maven-releases", Format: "maven2", Type: "hosted"},
+			{Name: "npm-proxy", Format: "npm", Type: "proxy"},
+		}
+		return fake
+	}
+
+	privilegeResource := func(t *testing.T, profile map[string]interface{}) *v2.Resource {
+		res, err := resource.NewRoleResource("", privilegeResourceType, "", []resource.RoleTraitOption{resource.WithRoleProfile(profile)})
+		if err != nil {
+			t.Fatalf("Failed to create privilege resource: %v", err)
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name     string
+		profile  map[string]interface{}
+		expected client.Privilege
+	}{
+		{
+			name: "repository-view",
+			profile: map[string]interface{}{
+				"name": "team-a-releases-write", "type": "repository-view", "format": "maven2", "repository": "maven-releases",
+				"actions": []interface{}{"browse", "read", "add", "edit"}, "pattern": "ignored",
+			},
+			expected: client.Privilege{
+				Type: "repository-view", Name: "team-a-releases-write", Format: "maven2", Repository: "maven-releases",
+				Actions: []string{"BROWSE", "READ", "ADD", "EDIT"},
+			},
+		},
+		{
+			name:     "repository-admin",
+			profile:  map[string]interface{}{"name": "npm-admin", "type": "repository-admin", "format": "*", "repository": "*", "actions": "ALL"},
+			expected: client.Privilege{Type: "repository-admin", Name: "npm-admin", Format: "*", Repository: "*", Actions: []string{"ALL"}},
+		},
+		{
+			name: "repository-content-selector",
+			profile: map[string]interface{}{
+				"name": "team-a-artifacts", "type": "repository-content-selector", "format": "npm", "repository": "npm-proxy",
+				"content_selector": "team-a", "actions": "read,browse",
+			},
+			expected: client.Privilege{
+				Type: "repository-content-selector", Name: "team-a-artifacts", Format: "npm", Repository: "npm-proxy",
+				ContentSelector: "team-a", Actions: []string{"READ", "BROWSE"},
+			},
+		},
+		{
+			name:     "wildcard",
+			profile:  map[string]interface{}{"name": "search", "type": "wildcard", "pattern": "nexus:search:read", "actions": "READ"},
+			expected: client.Privilege{Type: "wildcard", Name: "search", Pattern: "nexus:search:read"},
+		},
+	} {
+		t.Run("create "+tc.name, func(t *testing.T) {
+			fake := newFake(t)
+			created, _, err := newPrivilegeBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil)).Create(ctx, privilegeResource(t, tc.profile))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if created.Id.Resource != tc.expected.Name {
+				t.Errorf("Expected the created privilege to be returned, got %v", created.Id)
+			}
+
+			privilege := fake.Privilege(tc.expected.Name)
+			if privilege == nil {
+				t.Fatal("Expected the privilege to be created")
+			}
+			if !reflect.DeepEqual(*privilege, tc.expected) {
+				t.Errorf("Expected privilege %+v, got %+v", tc.expected, *privilege)
+			}
+		})
+	}
+
+	for name, profile := range map[string]map[string]interface{}{
+		"unsupported type":   {"name": "scripts", "type": "script"},
+		"missing type":       {"name": "scripts"},
+		"invalid name":       {"name": "team a", "type": "wildcard", "pattern": "nexus:*"},
+		"existing name":      {"name": "team-a-releases-read", "type": "wildcard", "pattern": "nexus:*"},
+		"missing pattern":    {"name": "search", "type": "wildcard"},
+		"empty pattern part": {"name": "search", "type": "wildcard", "pattern": "nexus::read"},
+		"invalid format":     {"name": "view", "type": "repository-view", "format": "Maven 2", "repository": "*", "actions": "READ"},
+		"missing repository": {"name": "view", "type": "repository-view", "format": "maven2", "actions": "READ"},
+		"unknown repository": {"name": "view", "type": "repository-view", "format": "maven2", "repository": "maven-snapshots", "actions": "READ"},
+		"mismatched format":  {"name": "view", "type": "repository-view", "format": "npm", "repository": "maven-releases", "actions": "READ"},
+		"missing actions":    {"name": "view", "type": "repository-view", "format": "*", "repository": "*"},
+		"invalid action":     {"name": "view", "type": "repository-view", "format": "*", "repository": "*", "actions": "READ,WRITE"},
+		"missing selector":   {"name": "view", "type": "repository-content-selector", "format": "*", "repository": "*", "actions": "READ"},
+	} {
+		t.Run("refuse "+name, func(t *testing.T) {
+			fake := newFake(t)
+			_, _, err := newPrivilegeBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil)).Create(ctx, privilegeResource(t, profile))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if len(fake.Privileges) != 2 {
+				t.Errorf("Expected no privilege to be created, got %v", fake.Privileges)
+			}
+		})
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		fake := newFake(t)
+		p := newPrivilegeBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+		privilegeID := func(name string) *v2.ResourceId {
+			return &v2.ResourceId{ResourceType: privilegeResourceType.Id, Resource: name}
+		}
+
+		_, err := p.Delete(ctx, privilegeID("team-a-releases-read"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if fake.Privilege("team-a-releases-read") != nil {
+			t.Error("Expected the privilege to be deleted")
+		}
+
+		for _, name := range []string{"nx-all", "unknown"} {
+			_, err := p.Delete(ctx, privilegeID(name))
+			if err == nil {
+				t.Errorf("Expected deleting %s to be refused", name)
+			}
+		}
+	})
+}
+
+func TestRoleBuilder_ConcurrentGrants(t *testing.T) {
+	ctx := context.Background()
+	fake := test.NewFakeNexus(t)
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}},
+	}
+
+	roleBuilder := newRoleBuilder(fake.Client(t), newSafeguard(fake.Client(t), "admin", nil))
+	principal := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"}}
+
+	expected := []string{"nx-anonymous"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := range 10 {
+		roleID := fmt.Sprintf("role-%d", i)
+		expected = append(expected, roleID)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := roleBuilder.Grant(ctx, principal, &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID(roleID)}})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if roles := fake.User("jdoe").Roles; !sameIDs(roles, expected) {
+		t.Errorf("Expected every granted role to be kept, got %v", roles)
+	}
+}
+
+func TestRoleBuilder_GrantRetriesOverwrittenUpdate(t *testing.T) {
+	ctx := context.Background()
+	principal := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"}}
+	deployers := &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID("nx-deployer")}}
+
+	newFake := func(t *testing.T, overwrites int) *test.FakeNexus {
+		fake := test.NewFakeNexus(t)
+		fake.Users = []*client.User{
+			{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}},
+		}
+		// Another client replaces the user with the roles it read before the update.
+		fake.UpdateHook = func(user *client.User) {
+			if overwrites > 0 {
+				overwrites--
+				user.Roles = []string{"nx-anonymous"}
+			}
+		}
+		return fake
+	}
+
+	t.Run("overwritten once", func(t *testing.T) {
+		fake := newFake(t, 1)
+		_, err := newRoleBuilder(fake.Client(t), nil).Grant(ctx, principal, deployers)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if roles := fake.User("jdoe").Roles; !reflect.DeepEqual(roles, []string{"nx-anonymous", "nx-deployer"}) {
+			t.Errorf("Expected the role to be granted, got %v", roles)
+		}
+		if n := fake.Requests(http.MethodPut, "/service/rest/v1/security/users/jdoe"); n != 2 {
+			t.Errorf("Expected the update to be retried once, got %d updates", n)
+		}
+	})
+
+	t.Run("always overwritten", func(t *testing.T) {
+		fake := newFake(t, roleUpdateAttempts)
+		_, err := newRoleBuilder(fake.Client(t), nil).Grant(ctx, principal, deployers)
+		if err == nil {
+			t.Fatal("Expected an error when the update keeps being overwritten")
+		}
+		if n := fake.Requests(http.MethodPut, "/service/rest/v1/security/users/jdoe"); n != roleUpdateAttempts {
+			t.Errorf("Expected %d updates, got %d", roleUpdateAttempts, n)
+		}
+	})
+}
+
+func TestGroupBuilder_LDAPGroups(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	fake.LDAPServers = []client.LDAPServer{
+		{ID: "1", Name: "corp-ldap", LDAPGroupsAsRoles: true},
+	}
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "LDAP", Roles: []string{"nx-anonymous"}, ExternalRoles: []string{"developers", "qa"}},
+		{UserID: "asmith", Source: "LDAP", ExternalRoles: []string{"developers"}},
+		{UserID: "admin", Source: "default", Roles: []string{"nx-admin"}},
+	}
+	fake.Roles = []client.Role{
+		{ID: "developers", Name: "developers", Source: "default", Privileges: []string{"nx-repository-view-*-*-read"}},
+		{ID: "nx-admin", Name: "nx-admin", Source: "default"},
+	}
+
+	ctx := context.Background()
+	c := fake.Client(t)
+	groupBuilder := newGroupBuilder(c)
+
+	groups, _, _, err := groupBuilder.List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(groups) != 2 || groups[0].Id.Resource != "developers" || groups[1].Id.Resource != "qa" {
+		t.Fatalf("Expected groups developers and qa, got %v", groups)
+	}
+
+	groupTrait, err := resource.GetGroupTrait(groups[0])
+	if err != nil {
+		t.Fatalf("Expected a group trait, got %v", err)
+	}
+	if mapped := groupTrait.GetProfile().GetFields()["mapped_role"].GetStringValue(); mapped != "developers" {
+		t.Errorf("Expected group developers to map to role developers, got %q", mapped)
+	}
+
+	roleEntitlements, _, _, err := newRoleBuilder(c, newSafeguard(c, "admin", nil)).Entitlements(ctx, &v2.Resource{Id: roleResourceID("developers")}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, rt := range roleEntitlements[0].GrantableTo {
+		if rt.Id == groupResourceType.Id {
+			t.Error("Expected roles not to be grantable to groups, as membership is managed in LDAP")
+		}
+	}
+
+	members, _, _, err := groupBuilder.Grants(ctx, groups[0], nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var memberIDs []string
+	for _, g := range members {
+		memberAnnos := annotations.Annotations(g.Annotations)
+		if !memberAnnos.Contains(&v2.GrantImmutable{}) {
+			t.Errorf("Expected membership of %s to be immutable", g.Principal.Id.Resource)
+		}
+		memberIDs = append(memberIDs, g.Principal.Id.Resource)
+	}
+	if !reflect.DeepEqual(memberIDs, []string{"LDAP/jdoe", "LDAP/asmith"}) {
+		t.Errorf("Expected members LDAP/jdoe and LDAP/asmith, got %v", memberIDs)
+	}
+
+	roleGrants, _, _, err := newRoleBuilder(c, newSafeguard(c, "admin", nil)).Grants(ctx, &v2.Resource{Id: roleResourceID("developers")}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(roleGrants) != 1 || roleGrants[0].Principal.Id.ResourceType != groupResourceType.Id {
+		t.Fatalf("Expected the role to be granted to the developers group only, got %v", roleGrants)
+	}
+	roleAnnos := annotations.Annotations(roleGrants[0].Annotations)
+	if !roleAnnos.Contains(&v2.GrantExpandable{}) {
+		t.Error("Expected the group grant to be expandable to the group members")
+	}
+	if !roleAnnos.Contains(&v2.GrantImmutable{}) {
+		t.Error("Expected the group grant to be immutable")
+	}
+
+	// A user sharing the ID of the group must not be touched by revoking the group grant.
+	fake.Users = append(fake.Users, &client.User{UserID: "developers", Source: "default", Roles: []string{"developers"}})
+	_, err = newRoleBuilder(c, newSafeguard(c, "admin", nil)).Revoke(ctx, roleGrants[0])
+	if err == nil || !strings.Contains(err.Error(), "only roles of users and roles can be revoked") {
+		t.Fatalf("Expected the revoke from a group to be refused, got %v", err)
+	}
+	if fake.Requests(http.MethodPut, "/service/rest/v1/security/users/developers") != 0 {
+		t.Error("Expected no update of the user sharing the group ID")
+	}
+}
+
+func TestRepositoryBuilder_ListAndEntitlements(t *testing.T) {
+	body, err := test.ReadFile("repositoriesMock.json")
+	if err != nil {
+		t.Fatalf("Error reading body: %s", err)
+	}
+	mockResponse := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	mockResponse.Header.Set("Content-Type", "application/json")
+
+	repositoryBuilder := newRepositoryBuilder(test.NewTestClient(mockResponse, nil))
+
+	ctx := context.Background()
+	resources, _, _, err := repositoryBuilder.List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(resources) != 3 {
+		t.Fatalf("Expected 3 repositories, got %d", len(resources))
+	}
+
+	appTrait, err := resource.GetAppTrait(resources[1])
+	if err != nil {
+		t.Fatalf("Expected app trait, got %v", err)
+	}
+	profile := appTrait.GetProfile().AsMap()
+	if profile["format"] != "npm" || profile["type"] != "proxy" || profile["blob_store"] != "npm" || profile["online"] != false {
+		t.Errorf("Unexpected repository profile: %v", profile)
+	}
+
+	entitlements, _, _, err := repositoryBuilder.Entitlements(ctx, resources[0], nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var slugs []string
+	for _, e := range entitlements {
+		slugs = append(slugs, e.Slug)
+	}
+	if !reflect.DeepEqual(slugs, []string{"browse", "read", "add", "edit", "delete"}) {
+		t.Errorf("Unexpected repository entitlements: %v", slugs)
+	}
+}
+
+func TestPrivilegeEvaluator_RepositoryActions(t *testing.T) {
+	privileges := []client.Privilege{
+		{Type: "wildcard", Name: "all", Pattern: "nexus:*"},
+		{Type: "application", Name: "nx-all", Domain: "*", Actions: []string{"ALL"}},
+		{Type: "wildcard", Name: "view-browse-read", Pattern: "nexus:repository-view:*:*:browse,read"},
+		{Type: "wildcard", Name: "npm-only", Pattern: "nexus:repository-view:npm:*:*"},
+		{Type: "repository-view", Name: "nx-repository-view-maven2-*-read", Format: "maven2", Repository: "*", Actions: []string{"READ"}},
+		{Type: "repository-view", Name: "releases-deploy", Format: "maven2", Repository: "maven-releases", Actions: []string{"ADD", "EDIT"}},
+		{Type: "repository-admin", Name: "admin-all", Format: "*", Repository: "*", Actions: []string{"ALL"}},
+		{Type: "repository-content-selector", Name: "acme-read", Format: "maven2", Repository: "*", ContentSelector: "acme", Actions: []string{"READ"}},
+		{Type: "wildcard", Name: "healthcheck", Pattern: "nexus:healthcheck:read"},
+	}
+	evaluator := newPrivilegeEvaluator(privileges)
+
+	releases := client.Repository{Name: "maven-releases", Format: "maven2"}
+
+	tests := []struct {
+		privilege string
+		expected  []string
+	}{
+		{"all", []string{"browse", "read", "add", "edit", "delete"}},
+		{"nx-all", []string{"browse", "read", "add", "edit", "delete"}},
+		{"view-browse-read", []string{"browse", "read"}},
+		{"npm-only", nil},
+		{"nx-repository-view-maven2-*-read", []string{"read"}},
+		{"releases-deploy", []string{"add", "edit"}},
+		{"admin-all", nil},
+		{"acme-read", []string{"read"}},
+		{"healthcheck", nil},
+		{"unknown", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.privilege, func(t *testing.T) {
+			actions := evaluator.repositoryActions(tt.privilege, releases)
+			if !reflect.DeepEqual(actions, tt.expected) {
+				t.Errorf("Expected actions %v, got %v", tt.expected, actions)
+			}
+		})
+	}
+
+	other := client.Repository{Name: "maven-snapshots", Format: "maven2"}
+	if actions := evaluator.repositoryActions("releases-deploy", other); actions != nil {
+		t.Errorf("Expected no actions on other repository, got %v", actions)
+	}
+}
+
+func TestRepositoryGrantsForRole(t *testing.T) {
+	evaluator := newPrivilegeEvaluator([]client.Privilege{
+		{Type: "repository-view", Name: "releases-read", Format: "maven2", Repository: "maven-releases", Actions: []string{"BROWSE", "READ"}},
+		{Type: "repository-content-selector", Name: "acme-add", Format: "maven2", Repository: "*", ContentSelector: "acme", Actions: []string{"ADD", "READ"}},
+	})
+
+	repositoryResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: repositoryResourceType.Id, Resource: "maven-releases"}}
+	role := client.Role{ID: "deployer", Privileges: []string{"releases-read", "acme-add"}}
+
+	grants := repositoryGrantsForRole(repositoryResource, client.Repository{Name: "maven-releases", Format: "maven2"}, role, evaluator)
+
+	expected := map[string]bool{
+		"repository:maven-releases:browse": false,
+		"repository:maven-releases:read":   false,
+		"repository:maven-releases:add":    true,
+	}
+	if len(grants) != len(expected) {
+		t.Fatalf("Expected %d grants, got %d", len(expected), len(grants))
+	}
+
+	for _, g := range grants {
+		contentSelectorOnly, ok := expected[g.Entitlement.Id]
+		if !ok {
+			t.Errorf("Unexpected grant on %s", g.Entitlement.Id)
+			continue
+		}
+
+		metadata := &v2.GrantMetadata{}
+		annos := annotations.Annotations(g.Annotations)
+		if _, err := annos.Pick(metadata); err != nil {
+			t.Fatalf("Expected grant metadata, got %v", err)
+		}
+		if metadata.Metadata.AsMap()["content_selector_only"] != contentSelectorOnly {
+			t.Errorf("Expected content_selector_only %v on %s", contentSelectorOnly, g.Entitlement.Id)
+		}
+		if !annos.Contains(&v2.GrantExpandable{}) {
+			t.Errorf("Expected grant on %s to be expandable", g.Entitlement.Id)
+		}
+	}
+}
+
+func TestContentSelectorBuilder(t *testing.T) {
+	ctx := context.Background()
+	fake := test.NewFakeNexus(t)
+	fake.ContentSelectors = []client.ContentSelector{
+		{Name: "acme-secret", Type: "csel", Description: "Secret artifacts", Expression: `path =^ "/com/acme/secret/"`},
+		{Name: "unused", Type: "csel", Expression: `format == "npm"`},
+	}
+	fake.Privileges = []client.Privilege{
+		{Type: "repository-content-selector", Name: "acme-secret-read", ContentSelector: "acme-secret", Format: "maven2", Repository: "maven-releases", Actions: []string{"BROWSE", "READ"}},
+		{Type: "repository-content-selector", Name: "acme-secret-all", ContentSelector: "acme-secret", Format: "*", Repository: "*", Actions: []string{"ALL"}},
+		{Type: "repository-view", Name: "nx-repository-view-*-*-read", Format: "*", Repository: "*", Actions: []string{"READ"}},
+	}
+
+	b := newContentSelectorBuilder(fake.Client(t))
+	resources, _, _, err := b.List(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("Expected 2 content selectors, got %d", len(resources))
+	}
+
+	appTrait, err := resource.GetAppTrait(resources[0])
+	if err != nil {
+		t.Fatalf("Expected an app trait, got %v", err)
+	}
+	profile := appTrait.GetProfile().AsMap()
+	if profile["expression"] != `path =^ "/com/acme/secret/"` {
+		t.Errorf("Expected the CSEL expression in the profile, got %v", profile["expression"])
+	}
+	if !reflect.DeepEqual(profile["privileges"], []interface{}{"acme-secret-read", "acme-secret-all"}) {
+		t.Errorf("Expected the referencing privileges in the profile, got %v", profile["privileges"])
+	}
+
+	grants, _, _, err := b.Grants(ctx, resources[0], nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var got []string
+	for _, g := range grants {
+		got = append(got, g.Principal.Id.Resource+" "+strings.TrimPrefix(g.Entitlement.Id, "content_selector:acme-secret:"))
+		annos := annotations.Annotations(g.Annotations)
+		if !annos.Contains(&v2.GrantExpandable{}) {
+			t.Errorf("Expected grant %s to be expandable", g.Id)
+		}
+	}
+	expected := []string{
+		"acme-secret-read browse", "acme-secret-read read",
+		"acme-secret-all browse", "acme-secret-all read", "acme-secret-all add", "acme-secret-all edit", "acme-secret-all delete",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected grants %v, got %v", expected, got)
+	}
+
+	grants, _, _, err = b.Grants(ctx, resources[1], nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(grants) != 0 {
+		t.Errorf("Expected no grants on an unused content selector, got %d", len(grants))
+	}
+
+	t.Run("not allowed to read content selectors", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Denied = []string{"/service/rest/v1/security/content-selectors"}
+
+		resources, _, _, err := newContentSelectorBuilder(fake.Client(t)).List(ctx, nil, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(resources) != 0 {
+			t.Errorf("Expected no content selectors, got %d", len(resources))
+		}
+	})
+}
+
+func TestSync_ListRequestsDoNotScaleWithUsers(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	for i := 0; i < 50; i++ {
+		fake.Users = append(fake.Users, &client.User{
+			UserID: fmt.Sprintf("user-%d", i),
+			Source: "default",
+			Status: "active",
+			Roles:  []string{"nx-anonymous"},
+		})
+	}
+	fake.Roles = []client.Role{
+		{ID: "nx-admin", Name: "nx-admin", Source: "default", Privileges: []string{"nx-all"}},
+		{ID: "nx-anonymous", Name: "nx-anonymous", Source: "default", Privileges: []string{"nx-repository-view-*-*-read"}},
+		{ID: "team-lead", Name: "team-lead", Source: "default", Roles: []string{"nx-admin"}},
+	}
+	fake.Privileges = []client.Privilege{
+		{Type: "wildcard", Name: "nx-all", Pattern: "nexus:*"},
+		{Type: "repository-view", Name: "nx-repository-view-*-*-read", Format: "*", Repository: "*", Actions: []string{"READ"}},
+	}
+	fake.Repositories = []client.Repository{
+		{Name: "maven-releases", Format: "maven2", Type: "hosted"},
+		{Name: "npm-proxy", Format: "npm", Type: "proxy"},
+	}
+
+	ctx := context.Background()
+	c := fake.Client(t)
+
+	type syncer interface {
+		List(context.Context, *v2.ResourceId, *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error)
+		Grants(context.Context, *v2.Resource, *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error)
+	}
+	defaultSource := &v2.ResourceId{ResourceType: userSourceResourceType.Id, Resource: defaultUserSource}
+
+	grantCount := 0
+	userCount := 0
+	for _, s := range []struct {
+		syncer syncer
+		parent *v2.ResourceId
+	}{
+		{syncer: newUserSourceBuilder(c)},
+		{syncer: newUserBuilder(c, Options{}, testPasswordPolicy(t), newSafeguard(c, "admin", nil)), parent: defaultSource},
+		{syncer: newGroupBuilder(c)},
+		{syncer: newRoleBuilder(c, newSafeguard(c, "admin", nil))},
+		{syncer: newPrivilegeBuilder(c, newSafeguard(c, "admin", nil))},
+		{syncer: newRepositoryBuilder(c)},
+		{syncer: newContentSelectorBuilder(c)},
+	} {
+		resources, _, _, err := s.syncer.List(ctx, s.parent, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, r := range resources {
+			if r.Id.ResourceType == userResourceType.Id {
+				userCount++
+			}
+			grants, _, _, err := s.syncer.Grants(ctx, r, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			grantCount += len(grants)
+		}
+	}
+
+	if userCount != 50 {
+		t.Errorf("Expected 50 users, got %d", userCount)
+	}
+
+	// 50 user memberships, 1 nested role, 2 role-to-privilege grants, 5 + 5 nx-all grants and 2 read grants on repositories.
+	if grantCount != 65 {
+		t.Errorf("Expected 65 grants, got %d", grantCount)
+	}
+
+	expectedRequests := map[string]int{
+		"/service/rest/v1/security/user-sources":      1,
+		"/service/rest/v1/security/users":             1,
+		"/service/rest/v1/security/roles":             2,
+		"/service/rest/v1/security/privileges":        2,
+		"/service/rest/v1/repositorySettings":         1,
+		"/service/rest/v1/security/ldap":              1,
+		"/service/rest/v1/security/content-selectors": 1,
+	}
+	for path, expected := range expectedRequests {
+		if got := fake.Requests(http.MethodGet, path); got != expected {
+			t.Errorf("Expected %d requests to %s, got %d", expected, path, got)
+		}
+	}
+}
+
+func TestNexusClient_ListAllUsers(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	// Nexus returns at most 100 users for a search on LDAP.
+	fake.UserSearchLimit = 100
+	fake.Users = []*client.User{
+		{UserID: "admin", Source: "default", Status: "active"},
+		{UserID: "ldap-user", Source: "LDAP", Status: "active"},
+		{UserID: "bob", Source: "LDAP", Status: "active"},
+		{UserID: "bob", Source: "default", Status: "active"},
+	}
+	for i := 0; i < 150; i++ {
+		fake.Users = append(fake.Users, &client.User{UserID: fmt.Sprintf("ldap-user-%03d", i), Source: "LDAP", Status: "active"})
+	}
+
+	users, err := fake.Client(t).ListAllUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	listed := make(map[string]bool)
+	for _, user := range users {
+		key := user.Source + "/" + user.UserID
+		if listed[key] {
+			t.Errorf("Expected user %s to be listed once", key)
+		}
+		listed[key] = true
+	}
+
+	if len(listed) != len(fake.Users) {
+		t.Errorf("Expected %d users, got %d", len(fake.Users), len(listed))
+	}
+	for _, user := range fake.Users {
+		if !listed[user.Source+"/"+user.UserID] {
+			t.Errorf("Expected user %s from source %s to be listed", user.UserID, user.Source)
+		}
+	}
+}
+
+func TestUserBuilder_QualifiedUserIDs(t *testing.T) {
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}},
+		{UserID: "jdoe", Source: "LDAP", Status: "active", Roles: []string{"nx-anonymous"}},
+		{UserID: "asmith", Source: "LDAP", Status: "active", Roles: []string{"nx-anonymous"}},
+	}
+	fake.Roles = []client.Role{
+		{ID: "nx-anonymous", Name: "nx-anonymous", Source: "default"},
+		{ID: "nx-deployer", Name: "nx-deployer", Source: "default"},
+	}
+
+	ctx := context.Background()
+	c := fake.Client(t)
+	userBuilder := newUserBuilder(c, Options{}, testPasswordPolicy(t), newSafeguard(c, "admin", nil))
+	roleBuilder := newRoleBuilder(c, newSafeguard(c, "admin", nil))
+
+	var ids []string
+	for _, source := range []string{"default", "LDAP"} {
+		resources, _, _, err := userBuilder.List(ctx, &v2.ResourceId{ResourceType: userSourceResourceType.Id, Resource: source}, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, r := range resources {
+			ids = append(ids, r.Id.Resource)
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"jdoe", "LDAP/jdoe", "LDAP/asmith"}) {
+		t.Errorf("Expected the LDAP accounts to be qualified, got %v", ids)
+	}
+
+	anonymous := &v2.Resource{Id: roleResourceID("nx-anonymous")}
+	grants, _, _, err := roleBuilder.Grants(ctx, anonymous, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var principals []string
+	for _, g := range grants {
+		principals = append(principals, g.Principal.Id.Resource)
+	}
+	if !reflect.DeepEqual(principals, []string{"jdoe", "LDAP/jdoe", "LDAP/asmith"}) {
+		t.Errorf("Expected a grant for every account, got %v", principals)
+	}
+
+	principal := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "LDAP/jdoe"}}
+	_, err = roleBuilder.Grant(ctx, principal, &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID("nx-deployer")}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(fake.Users[1].Roles, []string{"nx-anonymous", "nx-deployer"}) {
+		t.Errorf("Expected the role to be granted to the LDAP account, got %v", fake.Users[1].Roles)
+	}
+	if !reflect.DeepEqual(fake.Users[0].Roles, []string{"nx-anonymous"}) {
+		t.Errorf("Expected the local account to be unchanged, got %v", fake.Users[0].Roles)
+	}
+
+	_, err = userBuilder.Delete(ctx, principal.Id)
+	if err == nil || !strings.Contains(err.Error(), "only local (default source) users can be deleted") {
+		t.Errorf("Expected the deletion of the LDAP account to be refused, got %v", err)
+	}
+	if len(fake.Users) != 3 {
+		t.Errorf("Expected every account to be kept, got %d", len(fake.Users))
+	}
+}
+
+func newValidateFake(t *testing.T) *test.FakeNexus {
+	fake := test.NewFakeNexus(t)
+	fake.Users = []*client.User{
+		{UserID: "admin", Source: "default", Status: "active", Roles: []string{"nx-admin"}},
+		{UserID: "auditor", Source: "default", Status: "active", Roles: []string{"auditor"}},
+	}
+	fake.Roles = []client.Role{
+		{ID: "nx-admin", Name: "nx-admin", Source: "default", Privileges: []string{"nx-all"}},
+		{ID: "auditor", Name: "auditor", Source: "default", Privileges: []string{"nx-users-read"}},
+	}
+	fake.Privileges = []client.Privilege{
+		{Type: "wildcard", Name: "nx-all", Pattern: "nexus:*"},
+		{Type: "application", Name: "nx-users-read", Domain: "users", Actions: []string{"READ"}},
+	}
+	return fake
+}
+
+func TestConnector_Validate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("valid credentials", func(t *testing.T) {
+		fake := newValidateFake(t)
+		c := &Connector{client: fake.Client(t), username: "admin"}
+
+		_, err := c.Validate(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		fake := newValidateFake(t)
+		c := &Connector{client: fake.ClientWithPassword(t, "wrong"), username: "admin"}
+
+		_, err := c.Validate(ctx)
+		if err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+			t.Fatalf("Expected invalid credentials error, got %v", err)
+		}
+	})
+
+	t.Run("missing roles permission", func(t *testing.T) {
+		fake := newValidateFake(t)
+		fake.Denied = []string{"/service/rest/v1/security/roles"}
+		c := &Connector{client: fake.Client(t), username: "admin"}
+
+		_, err := c.Validate(ctx)
+		if err == nil || !strings.Contains(err.Error(), "nx-roles-read") {
+			t.Fatalf("Expected missing nx-roles-read error, got %v", err)
+		}
+	})
+
+	t.Run("repository settings not readable", func(t *testing.T) {
+		fake := newValidateFake(t)
+		fake.Denied = []string{"/service/rest/v1/repositorySettings"}
+		c := &Connector{client: fake.Client(t), username: "admin"}
+
+		_, err := c.Validate(ctx)
+		if err != nil {
+			t.Fatalf("Expected validation to fall back to the repositories listing, got %v", err)
+		}
+		if got := fake.Requests(http.MethodGet, "/service/rest/v1/repositories"); got != 1 {
+			t.Errorf("Expected 1 request to the repositories listing, got %d", got)
+		}
+	})
+
+	t.Run("unknown account", func(t *testing.T) {
+		fake := newValidateFake(t)
+		c := &Connector{client: fake.Client(t), username: "ghost"}
+
+		_, err := c.Validate(ctx)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Fatalf("Expected account not found error, got %v", err)
+		}
+	})
+
+	t.Run("provisioning through a directory mapping", func(t *testing.T) {
+		fake := newValidateFake(t)
+		fake.Users = append(fake.Users, &client.User{UserID: "svc-ldap", Source: "LDAP", Status: "active", ExternalRoles: []string{"nx-admin"}})
+		c := &Connector{client: fake.Client(t), username: "svc-ldap"}
+
+		var logs strings.Builder
+		logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&logs), zap.InfoLevel))
+
+		_, err := c.Validate(ctxzap.ToContext(ctx, logger))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !strings.Contains(logs.String(), "account can provision users") || strings.Contains(logs.String(), "missing_privileges") {
+			t.Errorf("Expected the directory-mapped roles to allow provisioning, got logs %s", logs.String())
+		}
+	})
+
+	t.Run("read-only account", func(t *testing.T) {
+		fake := newValidateFake(t)
+		c := &Connector{client: fake.Client(t), username: "auditor"}
+
+		_, err := c.Validate(ctx)
+		if err != nil {
+			t.Fatalf("Expected read-only account to pass validation, got %v", err)
+		}
+	})
+}
+
+func TestUserBuilder_CreateAccount_Roles(t *testing.T) {
+	ctx := context.Background()
+
+	newAccountInfo := func(t *testing.T, profile map[string]interface{}) *v2.AccountInfo {
+		p, err := structpb.NewStruct(profile)
+		if err != nil {
+			t.Fatalf("Failed to create profile: %v", err)
+		}
+		return &v2.AccountInfo{Profile: p}
+	}
+
+	profile := map[string]interface{}{
+		"userId":       "jdoe",
+		"firstName":    "John",
+		"lastName":     "Doe",
+		"emailAddress": "john.doe@example.com",
+	}
+	credentialOptions := &v2.CredentialOptions{
+		Options: &v2.CredentialOptions_RandomPassword_{
+			RandomPassword: &v2.CredentialOptions_RandomPassword{Length: 12},
+		},
+	}
+
+	t.Run("default roles", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Roles = []client.Role{{ID: "nx-anonymous"}, {ID: "developers"}}
+
+		u := newUserBuilder(fake.Client(t), Options{DefaultRoles: []string{"developers"}}, testPasswordPolicy(t), newSafeguard(fake.Client(t), "admin", nil))
+		_, _, _, err := u.CreateAccount(ctx, newAccountInfo(t, profile), credentialOptions)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if roles := fake.User("jdoe").Roles; !reflect.DeepEqual(roles, []string{"developers"}) {
+			t.Errorf("Expected default roles, got %v", roles)
+		}
+	})
+
+	t.Run("requested roles", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Roles = []client.Role{{ID: "nx-anonymous"}, {ID: "developers"}, {ID: "deployers"}}
+
+		withRoles := maps.Clone(profile)
+		withRoles["roles"] = []interface{}{"developers", "deployers"}
+
+		u := newUserBuilder(fake.Client(t), Options{DefaultRoles: []string{"nx-anonymous"}}, testPasswordPolicy(t), newSafeguard(fake.Client(t), "admin", nil))
+		_, _, _, err := u.CreateAccount(ctx, newAccountInfo(t, withRoles), credentialOptions)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if roles := fake.User("jdoe").Roles; !reflect.DeepEqual(roles, []string{"developers", "deployers"}) {
+			t.Errorf("Expected requested roles, got %v", roles)
+		}
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Roles = []client.Role{{ID: "nx-anonymous"}}
+
+		withRoles := maps.Clone(profile)
+		withRoles["roles"] = []interface{}{"developrs"}
+
+		u := newUserBuilder(fake.Client(t), Options{}, testPasswordPolicy(t), newSafeguard(fake.Client(t), "admin", nil))
+		_, _, _, err := u.CreateAccount(ctx, newAccountInfo(t, withRoles), credentialOptions)
+		if err == nil || !strings.Contains(err.Error(), "developrs") {
+			t.Fatalf("Expected unknown role error, got %v", err)
+		}
+
+		if fake.Requests(http.MethodPost, "/service/rest/v1/security/users") != 0 {
+			t.Error("Expected no user to be created")
+		}
+	})
+}
+
+func TestUserBuilder_Rotate(t *testing.T) {
+	ctx := context.Background()
+
+	fake := test.NewFakeNexus(t)
+	fake.Users = []*client.User{
+		// An LDAP account sharing the ID of the local account, listed first.
+		{UserID: "jdoe", Source: "LDAP", Status: "active", Roles: []string{"nx-anonymous"}},
+		{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}},
+		{UserID: "ldap.user", Source: "LDAP", Status: "active", Roles: []string{"nx-anonymous"}},
+	}
+
+	u := newUserBuilder(fake.Client(t), Options{}, testPasswordPolicy(t), newSafeguard(fake.Client(t), "admin", nil))
+	credentialOptions := &v2.CredentialOptions{
+		Options: &v2.CredentialOptions_RandomPassword_{
+			RandomPassword: &v2.CredentialOptions_RandomPassword{Length: 12},
+		},
+	}
+
+	plaintexts, _, err := u.Rotate(ctx, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"}, credentialOptions)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(plaintexts) != 1 || string(plaintexts[0].Bytes) == "" {
+		t.Fatalf("Expected the new password to be returned, got %v", plaintexts)
+	}
+	if fake.Passwords["jdoe"] != string(plaintexts[0].Bytes) {
+		t.Errorf("Expected the returned password to be set in Nexus")
+	}
+
+	_, _, err = u.Rotate(ctx, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "LDAP/jdoe"}, credentialOptions)
+	if err == nil || !strings.Contains(err.Error(), "source LDAP") {
+		t.Fatalf("Expected the qualified LDAP account to be refused, got %v", err)
+	}
+
+	_, _, err = u.Rotate(ctx, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "ldap.user"}, credentialOptions)
+	if err == nil || !strings.Contains(err.Error(), "source LDAP") {
+		t.Fatalf("Expected LDAP user to be refused, got %v", err)
+	}
+	if _, ok := fake.Passwords["ldap.user"]; ok {
+		t.Error("Expected no password change for the LDAP user")
+	}
+}
+
+func testPasswordPolicy(t *testing.T) *passwordPolicy {
+	policy, err := newPasswordPolicy(12, []string{"upper", "lower", "digit", "symbol"})
+	if err != nil {
+		t.Fatalf("Failed to create password policy: %v", err)
+	}
+	return policy
+}
+
+func TestPasswordPolicy_GenerateCredentials(t *testing.T) {
+	randomPassword := func(length int64, constraints ...*v2.PasswordConstraint) *v2.CredentialOptions {
+		return &v2.CredentialOptions{
+			Options: &v2.CredentialOptions_RandomPassword_{
+				RandomPassword: &v2.CredentialOptions_RandomPassword{Length: length, Constraints: constraints},
+			},
+		}
+	}
+
+	t.Run("requested length", func(t *testing.T) {
+		password, err := testPasswordPolicy(t).generateCredentials(randomPassword(32))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(password) != 32 {
+			t.Errorf("Expected a 32 character password, got %d", len(password))
+		}
+	})
+
+	t.Run("minimum length", func(t *testing.T) {
+		policy, err := newPasswordPolicy(20, []string{"upper", "lower", "digit"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		password, err := policy.generateCredentials(randomPassword(8))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(password) != 20 {
+			t.Errorf("Expected a 20 character password, got %d", len(password))
+		}
+		if strings.ContainsAny(password, passwordCharacterClasses["symbol"]) {
+			t.Errorf("Expected no symbols, got %q", password)
+		}
+		for _, class := range []string{"upper", "lower", "digit"} {
+			if !strings.ContainsAny(password, passwordCharacterClasses[class]) {
+				t.Errorf("Expected a %s character, got %q", class, password)
+			}
+		}
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		password, err := testPasswordPolicy(t).generateCredentials(randomPassword(16, &v2.PasswordConstraint{CharSet: "0123456789", MinCount: 6}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		digits := 0
+		for _, c := range password {
+			if c >= '0' && c <= '9' {
+				digits++
+			}
+		}
+		if digits < 6 {
+			t.Errorf("Expected at least 6 digits, got %q", password)
+		}
+	})
+
+	t.Run("maximum length", func(t *testing.T) {
+		_, err := testPasswordPolicy(t).generateCredentials(randomPassword(1 << 40))
+		if err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+			t.Fatalf("Expected an oversized password to be refused, got %v", err)
+		}
+
+		_, err = testPasswordPolicy(t).generateCredentials(randomPassword(16, &v2.PasswordConstraint{CharSet: "0123456789", MinCount: 1 << 30}))
+		if err == nil || !strings.Contains(err.Error(), "required by the constraints") {
+			t.Fatalf("Expected oversized constraints to be refused, got %v", err)
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		if _, err := newPasswordPolicy(6, []string{"lower"}); err == nil {
+			t.Error("Expected a minimum length below 8 to be refused")
+		}
+		if _, err := newPasswordPolicy(1024, []string{"lower"}); err == nil {
+			t.Error("Expected a minimum length above the maximum to be refused")
+		}
+		if _, err := newPasswordPolicy(12, []string{"emoji"}); err == nil {
+			t.Error("Expected an unknown character class to be refused")
+		}
+	})
+}
+
+func TestConnector_UserActions(t *testing.T) {
+	ctx := context.Background()
+
+	fake := test.NewFakeNexus(t)
+	fake.UserSources = []client.UserSource{
+		{ID: "default", Name: "Local"},
+		{ID: "LDAP", Name: "LDAP"},
+	}
+	fake.Users = []*client.User{
+		{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-deployer", "developers"}},
+		{UserID: "anonymous", Source: "default", Status: "active", Roles: []string{"nx-anonymous"}},
+		{UserID: "ldap.user", Source: "LDAP", Status: "active", Roles: []string{"nx-anonymous"}},
+	}
+	nexus := fake.Client(t)
+	c := &Connector{client: nexus, guard: newSafeguard(nexus, "admin", nil)}
+
+	invoke := func(t *testing.T, name, userID string) (*structpb.Struct, error) {
+		args, err := structpb.NewStruct(map[string]interface{}{"user_id": userID})
+		if err != nil {
+			t.Fatalf("Failed to create arguments: %v", err)
+		}
+		_, status, response, _, err := c.InvokeAction(ctx, name, args)
+		if err == nil && status != v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE {
+			t.Errorf("Expected the action to complete, got %v", status)
+		}
+		return response, err
+	}
+
+	for _, step := range []struct {
+		action  string
+		status  string
+		changed bool
+	}{
+		{disableUserAction, "disabled", true},
+		{disableUserAction, "disabled", false},
+		{enableUserAction, "active", true},
+		{enableUserAction, "active", false},
+	} {
+		response, err := invoke(t, step.action, "jdoe")
+		if err != nil {
+			t.Fatalf("Expected no error from %s, got %v", step.action, err)
+		}
+		if changed := response.GetFields()["changed"].GetBoolValue(); changed != step.changed {
+			t.Errorf("Expected %s to report changed=%v, got %v", step.action, step.changed, changed)
+		}
+
+		user := fake.User("jdoe")
+		if user.Status != step.status {
+			t.Errorf("Expected status %s after %s, got %s", step.status, step.action, user.Status)
+		}
+		if !reflect.DeepEqual(user.Roles, []string{"nx-deployer", "developers"}) {
+			t.Errorf("Expected roles to be kept after %s, got %v", step.action, user.Roles)
+		}
+	}
+
+	if got := fake.Requests(http.MethodPut, "/service/rest/v1/security/users/jdoe"); got != 2 {
+		t.Errorf("Expected 2 updates, got %d", got)
+	}
+
+	if _, err := invoke(t, disableUserAction, "anonymous"); err == nil || !strings.Contains(err.Error(), "anonymous") {
+		t.Errorf("Expected the anonymous user to be refused, got %v", err)
+	}
+	if _, err := invoke(t, disableUserAction, "ldap.user"); err == nil || !strings.Contains(err.Error(), "source LDAP") {
+		t.Errorf("Expected the LDAP user to be refused, got %v", err)
+	}
+	if fake.User("anonymous").Status != "active" || fake.User("ldap.user").Status != "active" {
+		t.Error("Expected refused users to be unchanged")
+	}
+}
+
+func TestUserBuilder_Delete(t *testing.T) {
+	ctx := context.Background()
+	userID := &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"}
+
+	for _, tc := range []struct {
+		mode   string
+		status string
+		roles  []string
+	}{
+		{mode: "delete"},
+		{mode: "disable", status: "disabled", roles: []string{"nx-deployer"}},
+		{mode: "disable-and-strip-roles", status: "disabled", roles: []string{"nx-anonymous"}},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			fake := test.NewFakeNexus(t)
+			fake.Users = []*client.User{
+				{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-deployer"}},
+			}
+
+			u := newUserBuilder(fake.Client(t), Options{DeleteMode: tc.mode, StrippedUserRole: "nx-anonymous"}, testPasswordPolicy(t), newSafeguard(fake.Client(t), "admin", nil))
+			_, err := u.Delete(ctx, userID)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			user := fake.User("jdoe")
+			if tc.mode == "delete" {
+				if user != nil {
+					t.Errorf("Expected the user to be deleted, got %v", user)
+				}
+				return
+			}
+
+			if user == nil {
+				t.Fatal("Expected the user to be kept")
+			}
+			if user.Status != tc.status {
+				t.Errorf("Expected status %s, got %s", tc.status, user.Status)
+			}
+			if !slices.Equal(user.Roles, tc.roles) {
+				t.Errorf("Expected roles %v, got %v", tc.roles, user.Roles)
+			}
+			if fake.Requests(http.MethodDelete, "/service/rest/v1/security/users/jdoe") != 0 {
+				t.Error("Expected no DELETE request")
+			}
+		})
+	}
+}
+
+func TestSafeguard(t *testing.T) {
+	ctx := context.Background()
+	fake := test.NewFakeNexus(t)
+	fake.Roles = []client.Role{
+		{ID: "nx-admin", Name: "nx-admin", Source: "default"},
+		{ID: "platform-admins", Name: "platform-admins", Source: "default", Roles: []string{"nx-admin"}},
+		{ID: "nx-deployer", Name: "nx-deployer", Source: "default"},
+	}
+	fake.Users = []*client.User{
+		{UserID: "admin", Source: "default", Status: "disabled", Roles: []string{"nx-admin"}},
+		{UserID: "baton", Source: "default", Status: "active", Roles: []string{"nx-deployer"}},
+		{UserID: "ops", Source: "default", Status: "active", Roles: []string{"platform-admins", "nx-deployer"}},
+		{UserID: "jdoe", Source: "default", Status: "active", Roles: []string{"nx-deployer", "nx-anonymous"}},
+	}
+
+	nexus := fake.Client(t)
+	guard := newSafeguard(nexus, "baton", []string{"admin", "anonymous"})
+	u := newUserBuilder(nexus, Options{}, testPasswordPolicy(t), guard)
+	r := newRoleBuilder(nexus, guard)
+	c := &Connector{client: nexus, guard: guard}
+
+	revoke := func(userID, roleID string) error {
+		_, err := r.Revoke(ctx, &v2.Grant{
+			Principal:   &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: userID}},
+			Entitlement: &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID(roleID)}},
+		})
+		return err
+	}
+
+	for _, userID := range []string{"admin", "baton", "ops"} {
+		t.Run("delete "+userID, func(t *testing.T) {
+			_, err := u.Delete(ctx, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: userID})
+			if err == nil {
+				t.Fatal("Expected the deletion to be refused")
+			}
+			if fake.User(userID) == nil {
+				t.Error("Expected the user to be kept")
+			}
+		})
+	}
+
+	t.Run("revoke the last admin", func(t *testing.T) {
+		if err := revoke("ops", "platform-admins"); err == nil {
+			t.Fatal("Expected the revoke to be refused")
+		}
+		if err := revoke("ops", "nx-deployer"); err != nil {
+			t.Fatalf("Expected a revoke keeping nx-admin to succeed, got %v", err)
+		}
+	})
+
+	t.Run("disable the last admin", func(t *testing.T) {
+		args, err := structpb.NewStruct(map[string]interface{}{"user_id": "ops"})
+		if err != nil {
+			t.Fatalf("Failed to create arguments: %v", err)
+		}
+		_, _, _, _, err = c.InvokeAction(ctx, disableUserAction, args)
+		if err == nil {
+			t.Fatal("Expected disabling the last admin to be refused")
+		}
+		if status := fake.User("ops").Status; status != "active" {
+			t.Errorf("Expected ops to stay active, got %s", status)
+		}
+	})
+
+	t.Run("connector account", func(t *testing.T) {
+		fake := test.NewFakeNexus(t)
+		fake.Privileges = []client.Privilege{
+			{Name: "nx-users-all", Type: "wildcard", Pattern: "nexus:users:*"},
+			{Name: "nx-roles-read", Type: "application", Domain: "roles", Actions: []string{"READ"}},
+			{Name: "nx-privileges-read", Type: "application", Domain: "privileges", Actions: []string{"READ"}},
+		}
+		fake.Roles = []client.Role{
+			{ID: "connector", Name: "connector", Source: "default", Privileges: []string{"nx-users-all", "nx-roles-read", "nx-privileges-read"}},
+			{ID: "nx-anonymous", Name: "nx-anonymous", Source: "default"},
+		}
+		fake.Users = []*client.User{
+			{UserID: "baton", Source: "default", Status: "active", Roles: []string{"connector", "nx-anonymous"}},
+		}
+		nexus := fake.Client(t)
+		r := newRoleBuilder(nexus, newSafeguard(nexus, "baton", nil))
+
+		revoke := func(roleID string) error {
+			_, err := r.Revoke(ctx, &v2.Grant{
+				Principal:   &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "baton"}},
+				Entitlement: &v2.Entitlement{Resource: &v2.Resource{Id: roleResourceID(roleID)}},
+			})
+			return err
+		}
+
+		if err := revoke("nx-anonymous"); err != nil {
+			t.Fatalf("Expected revoking a role the connector does not need to succeed, got %v", err)
+		}
+		if err := revoke("connector"); err == nil {
+			t.Fatal("Expected revoking the connector's privileges to be refused")
+		}
+		if roles := fake.User("baton").Roles; !reflect.DeepEqual(roles, []string{"connector"}) {
+			t.Errorf("Expected the connector role to be kept, got %v", roles)
+		}
+	})
+
+	t.Run("built-in users are always protected", func(t *testing.T) {
+		guard := newSafeguard(nexus, "baton", []string{"ops"})
+		for _, userID := range []string{"admin", "anonymous", "ops"} {
+			if err := guard.checkProtected(userID, "delete"); err == nil {
+				t.Errorf("Expected %s to be protected", userID)
+			}
+		}
+	})
+
+	t.Run("users are only listed when nx-admin is taken away", func(t *testing.T) {
+		nexus := fake.Client(t)
+		guard := newSafeguard(nexus, "baton", nil)
+		listings := func() int { return fake.Requests(http.MethodGet, "/service/rest/v1/security/user-sources") }
+
+		before := listings()
+		err := guard.checkRoleRevoke(ctx, fake.User("ops"), []string{"platform-admins"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if listings() != before {
+			t.Error("Expected no user listing for a revoke keeping nx-admin")
+		}
+
+		err = guard.checkRoleRevoke(ctx, fake.User("jdoe"), nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if listings() != before {
+			t.Error("Expected no user listing for a user without nx-admin")
+		}
+
+		err = guard.checkRoleRevoke(ctx, fake.User("ops"), nil)
+		if err == nil {
+			t.Fatal("Expected the revoke to be refused")
+		}
+		if listings() == before {
+			t.Error("Expected users to be listed when nx-admin is taken away")
+		}
+
+		err = guard.checkRoleChange(ctx, "nx-deployer", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := guard.checkRoleChange(ctx, "platform-admins", &client.Role{ID: "platform-admins"}); err == nil {
+			t.Error("Expected removing nx-admin from the last admin role to be refused")
+		}
+		if err := guard.checkRoleChange(ctx, "platform-admins", nil); err == nil {
+			t.Error("Expected deleting the last admin role to be refused")
+		}
+	})
+
+	t.Run("unprotected user", func(t *testing.T) {
+		if err := revoke("jdoe", "nx-deployer"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		_, err := u.Delete(ctx, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "jdoe"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
 }
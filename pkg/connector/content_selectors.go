@@ -0,0 +1,156 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var contentSelectorActionDescriptions = map[string]string{
+	"browse": "Browse the content matched by content selector: %s",
+	"read":   "Read components matched by content selector: %s",
+	"add":    "Add (deploy) components matched by content selector: %s",
+	"edit":   "Edit components matched by content selector: %s",
+	"delete": "Delete components matched by content selector: %s",
+}
+
+type contentSelectorBuilder struct {
+	client *client.APIClient
+}
+
+func (o *contentSelectorBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return contentSelectorResourceType
+}
+
+// List returns all the content selectors from Nexus as resource objects, with their CSEL expression and the
+// privileges that reference them in the profile. An account that is not allowed to read content selectors
+// gets no content selectors, so that syncs keep working without them.
+func (o *contentSelectorBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	selectors, annos, err := o.client.ListContentSelectors(ctx)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.PermissionDenied, codes.NotFound:
+		ctxzap.Extract(ctx).Warn(
+			"cannot read content selectors, content selectors are not synced, assign the account a role with the nx-selectors-read privilege",
+			zap.Error(err),
+		)
+		return nil, "", nil, nil
+	default:
+		return nil, "", nil, err
+	}
+
+	privileges, err := o.client.PrivilegesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	for _, selector := range selectors {
+		var privilegeNames []string
+		for _, privilege := range privileges {
+			if privilege.Type == privilegeTypeContentSelector && privilege.ContentSelector == selector.Name {
+				privilegeNames = append(privilegeNames, privilege.Name)
+			}
+		}
+
+		profile := map[string]interface{}{
+			"name":        selector.Name,
+			"type":        selector.Type,
+			"description": selector.Description,
+			"expression":  selector.Expression,
+			"privileges":  toInterfaceSlice(privilegeNames),
+		}
+
+		selectorTraits := []resource.AppTraitOption{
+			resource.WithAppProfile(profile),
+		}
+
+		selectorResource, err := resource.NewAppResource(
+			selector.Name,
+			contentSelectorResourceType,
+			selector.Name,
+			selectorTraits,
+			resource.WithDescription(fmt.Sprintf("Content matching %s", selector.Expression)),
+		)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating content selector resource: %w", err)
+		}
+
+		resources = append(resources, selectorResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+// Entitlements returns an entitlement for each repository-view action on the content matched by the selector.
+func (o *contentSelectorBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var entitlements []*v2.Entitlement
+
+	for _, action := range repositoryActions {
+		opts := []entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(privilegeResourceType),
+			entitlement.WithDescription(fmt.Sprintf(contentSelectorActionDescriptions[action], resource.DisplayName)),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, action)),
+		}
+
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, action, opts...))
+	}
+
+	return entitlements, "", nil, nil
+}
+
+// Grants returns a grant for each action that a repository-content-selector privilege referencing the selector allows.
+// Grants are expandable so that the roles holding the privilege, and their users, are shown with the same access.
+// The grant metadata lists the repositories the privilege is limited to.
+func (o *contentSelectorBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	privileges, err := o.client.PrivilegesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var grants []*v2.Grant
+	for _, privilege := range privileges {
+		if privilege.Type != privilegeTypeContentSelector || privilege.ContentSelector != resource.Id.Resource {
+			continue
+		}
+
+		actions := normalizeActions(privilege.Actions)
+		for _, action := range repositoryActions {
+			if !slices.Contains(actions, wildcardToken) && !slices.Contains(actions, action) {
+				continue
+			}
+
+			g := grant.NewGrant(
+				resource,
+				action,
+				privilegeResourceID(privilege.Name),
+				grant.WithAnnotation(privilegeExpandable(privilege.Name)),
+				grant.WithGrantMetadata(map[string]interface{}{
+					"format":     valueOrWildcard(privilege.Format),
+					"repository": valueOrWildcard(privilege.Repository),
+				}),
+			)
+			grants = append(grants, g)
+		}
+	}
+
+	return grants, "", nil, nil
+}
+
+func newContentSelectorBuilder(client *client.APIClient) *contentSelectorBuilder {
+	return &contentSelectorBuilder{
+		client: client,
+	}
+}
@@ -0,0 +1,232 @@
+package connector
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+const (
+	privilegeTypeApplication     = "application"
+	privilegeTypeRepositoryView  = "repository-view"
+	privilegeTypeRepositoryAdmin = "repository-admin"
+	privilegeTypeContentSelector = "repository-content-selector"
+	privilegeTypeWildcard        = "wildcard"
+)
+
+const (
+	wildcardToken          = "*"
+	wildcardPartDivider    = ":"
+	wildcardSubpartDivider = ","
+)
+
+// wildcardPermission is a parsed Nexus (Apache Shiro) wildcard permission string such as
+// "nexus:repository-view:maven2:*:browse,read". Each part may hold several comma separated
+// values, and "*" matches anything.
+type wildcardPermission [][]string
+
+func parseWildcardPermission(pattern string) wildcardPermission {
+	var permission wildcardPermission
+	for _, part := range strings.Split(strings.ToLower(strings.TrimSpace(pattern)), wildcardPartDivider) {
+		var subparts []string
+		for _, subpart := range strings.Split(part, wildcardSubpartDivider) {
+			if subpart = strings.TrimSpace(subpart); subpart != "" {
+				subparts = append(subparts, subpart)
+			}
+		}
+		permission = append(permission, subparts)
+	}
+	return permission
+}
+
+// implies reports whether the permission grants the required permission parts.
+// Following Shiro semantics, a permission with fewer parts implies all of the remaining parts,
+// while any extra parts of the permission must be wildcards.
+func (p wildcardPermission) implies(required ...string) bool {
+	for i, value := range required {
+		if i >= len(p) {
+			return true
+		}
+		part := p[i]
+		if !slices.Contains(part, wildcardToken) && !slices.Contains(part, strings.ToLower(value)) {
+			return false
+		}
+	}
+
+	for i := len(required); i < len(p); i++ {
+		if !slices.Contains(p[i], wildcardToken) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// privilegeEvaluator expands Nexus privileges into the permissions they grant.
+type privilegeEvaluator struct {
+	privileges  map[string]client.Privilege
+	permissions map[string]wildcardPermission
+}
+
+func newPrivilegeEvaluator(privileges []client.Privilege) *privilegeEvaluator {
+	e := &privilegeEvaluator{
+		privileges:  make(map[string]client.Privilege, len(privileges)),
+		permissions: make(map[string]wildcardPermission, len(privileges)),
+	}
+
+	for _, privilege := range privileges {
+		e.privileges[privilege.Name] = privilege
+		if permission, ok := privilegePermission(privilege); ok {
+			e.permissions[privilege.Name] = permission
+		}
+	}
+
+	return e
+}
+
+// privilegePermission returns the wildcard permission equivalent to the privilege.
+// Content selector privileges are expressed as repository-view permissions, since they grant
+// the same actions restricted to the content matched by the selector.
+func privilegePermission(privilege client.Privilege) (wildcardPermission, bool) {
+	switch privilege.Type {
+	case privilegeTypeWildcard:
+		if privilege.Pattern == "" {
+			return nil, false
+		}
+		return parseWildcardPermission(privilege.Pattern), true
+	case privilegeTypeApplication:
+		return wildcardPermission{
+			{"nexus"},
+			{strings.ToLower(valueOrWildcard(privilege.Domain))},
+			normalizeActions(privilege.Actions),
+		}, true
+	case privilegeTypeRepositoryView, privilegeTypeContentSelector:
+		return wildcardPermission{
+			{"nexus"},
+			{privilegeTypeRepositoryView},
+			{strings.ToLower(valueOrWildcard(privilege.Format))},
+			{strings.ToLower(valueOrWildcard(privilege.Repository))},
+			normalizeActions(privilege.Actions),
+		}, true
+	case privilegeTypeRepositoryAdmin:
+		return wildcardPermission{
+			{"nexus"},
+			{privilegeTypeRepositoryAdmin},
+			{strings.ToLower(valueOrWildcard(privilege.Format))},
+			{strings.ToLower(valueOrWildcard(privilege.Repository))},
+			normalizeActions(privilege.Actions),
+		}, true
+	}
+
+	return nil, false
+}
+
+// implies reports whether the named privilege grants the required permission parts.
+func (e *privilegeEvaluator) implies(privilegeName string, required ...string) bool {
+	permission, ok := e.permissions[privilegeName]
+	if !ok {
+		return false
+	}
+	return permission.implies(required...)
+}
+
+// repositoryActions returns the repository-view actions that the named privilege grants on the repository.
+func (e *privilegeEvaluator) repositoryActions(privilegeName string, repository client.Repository) []string {
+	var actions []string
+	for _, action := range repositoryActions {
+		if e.implies(privilegeName, "nexus", privilegeTypeRepositoryView, repository.Format, repository.Name, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// isContentSelector reports whether the named privilege only grants access to the content matched by a selector.
+func (e *privilegeEvaluator) isContentSelector(privilegeName string) bool {
+	return e.privileges[privilegeName].Type == privilegeTypeContentSelector
+}
+
+func valueOrWildcard(value string) string {
+	if value == "" {
+		return wildcardToken
+	}
+	return value
+}
+
+// normalizeActions converts privilege actions to wildcard permission values, where ALL means any action.
+func normalizeActions(actions []string) []string {
+	if len(actions) == 0 {
+		return []string{wildcardToken}
+	}
+
+	normalized := make([]string, 0, len(actions))
+	for _, action := range actions {
+		action = strings.ToLower(action)
+		if action == "all" {
+			action = wildcardToken
+		}
+		normalized = append(normalized, action)
+	}
+	return normalized
+}
+
+// effectivePrivileges returns the privileges granted by the given roles, including the privileges
+// of every role nested inside them.
+func effectivePrivileges(roles []client.Role, roleIDs []string) []string {
+	rolesByID := make(map[string]client.Role, len(roles))
+	for _, role := range roles {
+		rolesByID[role.ID] = role
+	}
+
+	var privileges []string
+	for _, roleID := range effectiveRoles(roles, roleIDs) {
+		for _, privilege := range rolesByID[roleID].Privileges {
+			if !slices.Contains(privileges, privilege) {
+				privileges = append(privileges, privilege)
+			}
+		}
+	}
+
+	return privileges
+}
+
+// effectiveRoles returns the given roles and every role nested inside them.
+// Nested roles that form a cycle are only visited once, and unknown roles are left out.
+func effectiveRoles(roles []client.Role, roleIDs []string) []string {
+	rolesByID := make(map[string]client.Role, len(roles))
+	for _, role := range roles {
+		rolesByID[role.ID] = role
+	}
+
+	var result []string
+	visited := make(map[string]bool)
+	queue := slices.Clone(roleIDs)
+	for len(queue) > 0 {
+		roleID := queue[0]
+		queue = queue[1:]
+		if visited[roleID] {
+			continue
+		}
+		visited[roleID] = true
+
+		role, ok := rolesByID[roleID]
+		if !ok {
+			continue
+		}
+		result = append(result, roleID)
+		queue = append(queue, role.Roles...)
+	}
+
+	return result
+}
+
+// impliesAny reports whether any of the named privileges grants the required permission parts.
+func (e *privilegeEvaluator) impliesAny(privilegeNames []string, required ...string) bool {
+	for _, privilegeName := range privilegeNames {
+		if e.implies(privilegeName, required...) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+// memberEntitlement is the entitlement slug used for LDAP group membership.
+const memberEntitlement = "member"
+
+// ldapGroup is an LDAP group known to Nexus. Nexus maps a group to the role whose ID matches the group name.
+type ldapGroup struct {
+	id         string
+	mappedRole *client.Role
+}
+
+type groupBuilder struct {
+	client *client.APIClient
+}
+
+func (o *groupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return groupResourceType
+}
+
+// List returns the LDAP groups known to Nexus as resource objects.
+func (o *groupBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	groups, err := ldapGroups(ctx, o.client)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	for _, group := range groups {
+		profile := map[string]interface{}{
+			"group_name": group.id,
+		}
+		if group.mappedRole != nil {
+			profile["mapped_role"] = group.mappedRole.ID
+		}
+
+		groupResource, err := resource.NewGroupResource(
+			group.id,
+			groupResourceType,
+			group.id,
+			[]resource.GroupTraitOption{resource.WithGroupProfile(profile)},
+		)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating group resource: %w", err)
+		}
+
+		resources = append(resources, groupResource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements returns the membership entitlement of an LDAP group.
+func (o *groupBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var entitlements []*v2.Entitlement
+
+	opts := []entitlement.EntitlementOption{
+		entitlement.WithGrantableTo(userResourceType),
+		entitlement.WithDescription(fmt.Sprintf("Member of LDAP group: %s", resource.DisplayName)),
+		entitlement.WithDisplayName(fmt.Sprintf("Group: %s", resource.DisplayName)),
+	}
+
+	entitlements = append(entitlements, entitlement.NewAssignmentEntitlement(resource, memberEntitlement, opts...))
+	return entitlements, "", nil, nil
+}
+
+// Grants returns a grant for every LDAP user whose directory groups include the group.
+// Membership is managed in LDAP, so the grants are marked immutable.
+func (o *groupBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	groupID := resource.Id.Resource
+
+	users, err := o.client.UsersSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var grants []*v2.Grant
+	for _, user := range users {
+		if user.Source != client.LDAPUserSource || !slices.Contains(user.ExternalRoles, groupID) {
+			continue
+		}
+
+		grants = append(grants, grant.NewGrant(
+			resource,
+			memberEntitlement,
+			userResourceID(user),
+			grant.WithAnnotation(&v2.GrantImmutable{SourceId: client.LDAPUserSource}),
+		))
+	}
+
+	return grants, "", nil, nil
+}
+
+// ldapGroups returns the LDAP groups known to Nexus, when an LDAP server maps groups to roles.
+// Groups are taken from the roles mapped from LDAP and from the directory groups of LDAP users,
+// and each group is matched by name with the role it maps to, which usually is a default source role.
+func ldapGroups(ctx context.Context, c *client.APIClient) ([]ldapGroup, error) {
+	servers, err := c.LDAPServersSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(servers, func(s client.LDAPServer) bool { return s.LDAPGroupsAsRoles }) {
+		return nil, nil
+	}
+
+	roles, err := c.RolesSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := c.UsersSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*ldapGroup)
+	for _, role := range roles {
+		if role.Source == client.LDAPUserSource {
+			groups[role.ID] = &ldapGroup{id: role.ID}
+		}
+	}
+	for _, user := range users {
+		if user.Source != client.LDAPUserSource {
+			continue
+		}
+		for _, groupID := range user.ExternalRoles {
+			if _, ok := groups[groupID]; !ok {
+				groups[groupID] = &ldapGroup{id: groupID}
+			}
+		}
+	}
+	for i, role := range roles {
+		if group, ok := groups[role.ID]; ok {
+			group.mappedRole = &roles[i]
+		}
+	}
+
+	result := make([]ldapGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	slices.SortFunc(result, func(a, b ldapGroup) int { return strings.Compare(a.id, b.id) })
+
+	return result, nil
+}
+
+// groupExpandable marks a grant held by an LDAP group so that it is expanded to every member of the group.
+func groupExpandable(groupID string) *v2.GrantExpandable {
+	groupResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: groupResourceType.Id, Resource: groupID}}
+	return &v2.GrantExpandable{
+		EntitlementIds: []string{entitlement.NewEntitlementID(groupResource, memberEntitlement)},
+	}
+}
+
+func newGroupBuilder(client *client.APIClient) *groupBuilder {
+	return &groupBuilder{
+		client: client,
+	}
+}
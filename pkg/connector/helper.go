@@ -1,24 +1,316 @@
 package connector
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
-	"github.com/conductorone/baton-sdk/pkg/crypto"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
 )
 
-func generateCredentials(credentialOptions *v2.CredentialOptions) (string, error) {
-	if credentialOptions.GetRandomPassword() == nil {
+const (
+	// minimumPasswordLength is the shortest password the connector will ever generate.
+	minimumPasswordLength = 8
+	// maximumPasswordLength is the longest password the connector will generate.
+	maximumPasswordLength = 256
+)
+
+// passwordCharacterClasses are the character classes a generated password can be built from.
+var passwordCharacterClasses = map[string]string{
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"digit":  "0123456789",
+	"symbol": "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// passwordPolicy describes the passwords generated for Nexus users.
+// Every generated password is at least minLength long, only uses the configured character
+// classes and contains at least one character from each of them.
+type passwordPolicy struct {
+	minLength int64
+	classes   []string
+}
+
+func newPasswordPolicy(minLength int64, classes []string) (*passwordPolicy, error) {
+	if minLength < minimumPasswordLength {
+		return nil, fmt.Errorf("baton-sonatype-nexus: password minimum length must be at least %d, got %d", minimumPasswordLength, minLength)
+	}
+
+	if len(classes) == 0 {
+		return nil, errors.New("baton-sonatype-nexus: at least one password character class is required")
+	}
+
+	for _, class := range classes {
+		if _, ok := passwordCharacterClasses[class]; !ok {
+			return nil, fmt.Errorf("baton-sonatype-nexus: unknown password character class %q, expected one of upper, lower, digit, symbol", class)
+		}
+	}
+
+	if minLength > maximumPasswordLength {
+		return nil, fmt.Errorf("baton-sonatype-nexus: password minimum length must be at most %d, got %d", maximumPasswordLength, minLength)
+	}
+
+	if int64(len(classes)) > minLength {
+		return nil, fmt.Errorf("baton-sonatype-nexus: password minimum length %d is too short for %d character classes", minLength, len(classes))
+	}
+
+	return &passwordPolicy{
+		minLength: minLength,
+		classes:   classes,
+	}, nil
+}
+
+// generateCredentials returns a random password honoring the requested length and constraints.
+// Requests for passwords shorter than the policy minimum are raised to the minimum.
+func (p *passwordPolicy) generateCredentials(credentialOptions *v2.CredentialOptions) (string, error) {
+	randomPassword := credentialOptions.GetRandomPassword()
+	if randomPassword == nil {
 		return "", errors.New("unsupported credential option")
 	}
 
-	password, err := crypto.GenerateRandomPassword(
-		&v2.CredentialOptions_RandomPassword{
-			Length: min(12, credentialOptions.GetRandomPassword().GetLength()),
-		},
-	)
+	length := max(p.minLength, randomPassword.GetLength())
+	if length > maximumPasswordLength {
+		return "", fmt.Errorf("baton-sonatype-nexus: password length %d exceeds the maximum of %d", length, maximumPasswordLength)
+	}
+
+	var required int64
+	for _, constraint := range randomPassword.GetConstraints() {
+		required += int64(constraint.GetMinCount())
+	}
+	if required > length {
+		return "", fmt.Errorf("baton-sonatype-nexus: password length %d is less than the %d characters required by the constraints", length, required)
+	}
+
+	var password []byte
+	for _, constraint := range randomPassword.GetConstraints() {
+		for range constraint.GetMinCount() {
+			c, err := randomCharacter(constraint.GetCharSet())
+			if err != nil {
+				return "", err
+			}
+			password = append(password, c)
+		}
+	}
+
+	var charset strings.Builder
+	for _, class := range p.classes {
+		set := passwordCharacterClasses[class]
+		charset.WriteString(set)
+
+		if strings.ContainsAny(string(password), set) {
+			continue
+		}
+		c, err := randomCharacter(set)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	if int64(len(password)) > length {
+		return "", fmt.Errorf("baton-sonatype-nexus: password length %d is less than the %d characters required by the constraints", length, len(password))
+	}
+
+	for int64(len(password)) < length {
+		c, err := randomCharacter(charset.String())
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	err := shuffle(password)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.check(string(password), randomPassword.GetConstraints())
 	if err != nil {
 		return "", err
 	}
-	return password, nil
+
+	return string(password), nil
+}
+
+// check verifies that a password satisfies the policy and the requested constraints.
+func (p *passwordPolicy) check(password string, constraints []*v2.PasswordConstraint) error {
+	if int64(len(password)) < p.minLength {
+		return fmt.Errorf("baton-sonatype-nexus: password is shorter than the minimum length of %d", p.minLength)
+	}
+
+	for _, class := range p.classes {
+		if !strings.ContainsAny(password, passwordCharacterClasses[class]) {
+			return fmt.Errorf("baton-sonatype-nexus: password does not contain a %s character", class)
+		}
+	}
+
+	for _, constraint := range constraints {
+		count := 0
+		for _, c := range password {
+			if strings.ContainsRune(constraint.GetCharSet(), c) {
+				count++
+			}
+		}
+		if count < int(constraint.GetMinCount()) {
+			return fmt.Errorf("baton-sonatype-nexus: password does not contain %d characters from %q", constraint.GetMinCount(), constraint.GetCharSet())
+		}
+	}
+
+	return nil
+}
+
+func randomCharacter(set string) (byte, error) {
+	if set == "" {
+		return 0, errors.New("baton-sonatype-nexus: empty password character set")
+	}
+
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	return set[index.Int64()], nil
+}
+
+func shuffle(password []byte) error {
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return nil
+}
+
+// lookupUser returns the user with the given ID. An empty source searches every user source and prefers the
+// local user when the ID exists in more than one source, matching the unqualified user resource ID.
+func lookupUser(ctx context.Context, c *client.APIClient, userId, source string) (*client.User, error) {
+	var users []*client.User
+	var err error
+	if source != "" {
+		users, _, err = c.ListUsersBySource(ctx, source, userId)
+	} else {
+		users, _, err = c.ListUsersByID(ctx, userId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by id: %w", err)
+	}
+
+	var found *client.User
+	for _, u := range users {
+		if u.UserID != userId || (source != "" && u.Source != source) {
+			continue
+		}
+		if found == nil || u.Source == defaultUserSource {
+			found = u
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("user %s not found", userId)
+	}
+
+	return found, nil
+}
+
+// userResourceID returns the resource ID of a user. Users of sources other than default are always qualified
+// with their source, as in LDAP/jdoe, so that accounts with the same ID in several sources are all kept.
+// Nexus addresses users by ID in the URL path, so user IDs do not contain a slash.
+func userResourceID(user *client.User) *v2.ResourceId {
+	id := user.UserID
+	if user.Source != "" && user.Source != defaultUserSource {
+		id = user.Source + "/" + user.UserID
+	}
+	return &v2.ResourceId{
+		ResourceType: userResourceType.Id,
+		Resource:     id,
+	}
+}
+
+// parseUserResourceID returns the user ID of a user resource ID and, for qualified IDs, the source of the user.
+// Unqualified IDs are local users, or users of any source synced before IDs were qualified.
+func parseUserResourceID(id string) (string, string) {
+	source, userID, ok := strings.Cut(id, "/")
+	if !ok {
+		return id, ""
+	}
+	return userID, source
+}
+
+// toInterfaceSlice converts a string slice into a form that can be stored in a resource profile.
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// roleResourceID returns the resource ID of the Nexus role with the given ID.
+func roleResourceID(roleID string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: roleResourceType.Id,
+		Resource:     roleID,
+	}
+}
+
+// roleExpandable marks a grant held by a role so that it is expanded to every holder of that role.
+func roleExpandable(roleID string) *v2.GrantExpandable {
+	roleResource := &v2.Resource{Id: roleResourceID(roleID)}
+	return &v2.GrantExpandable{
+		EntitlementIds: []string{entitlement.NewEntitlementID(roleResource, assignedEntitlement)},
+	}
+}
+
+// privilegeResourceID returns the resource ID of the Nexus privilege with the given name.
+func privilegeResourceID(name string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: privilegeResourceType.Id,
+		Resource:     name,
+	}
+}
+
+// privilegeExpandable marks a grant held by a privilege so that it is expanded to every role including the privilege.
+func privilegeExpandable(name string) *v2.GrantExpandable {
+	privilegeResource := &v2.Resource{Id: privilegeResourceID(name)}
+	return &v2.GrantExpandable{
+		EntitlementIds: []string{entitlement.NewEntitlementID(privilegeResource, assignedEntitlement)},
+	}
+}
+
+// profileStringList reads a list of strings from an account profile. The value may be a list or
+// a comma separated string, and is empty when the key is missing.
+func profileStringList(profile map[string]interface{}, key string) ([]string, error) {
+	var values []string
+
+	switch v := profile[key].(type) {
+	case nil:
+	case string:
+		values = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid '%s' in profile", key)
+			}
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid '%s' in profile", key)
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
 }
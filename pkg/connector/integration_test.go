@@ -35,9 +35,9 @@ func initClient(t *testing.T) *client.APIClient {
 func TestUserBuilderList(t *testing.T) {
 	c := initClient(t)
 
-	u := newUserBuilder(c)
+	u := newUserBuilder(c, Options{}, nil, newSafeguard(c, "admin", nil))
 
-	res, _, _, err := u.List(ctx, parentResourceID, nil)
+	res, _, _, err := u.List(ctx, &v2.ResourceId{ResourceType: userSourceResourceType.Id, Resource: defaultUserSource}, nil)
 	assert.Nil(t, err)
 	assert.NotNil(t, res)
 
@@ -47,7 +47,7 @@ func TestUserBuilderList(t *testing.T) {
 func TestRoleBuilderList(t *testing.T) {
 	c := initClient(t)
 
-	r := newRoleBuilder(c)
+	r := newRoleBuilder(c, newSafeguard(c, "admin", nil))
 
 	res, _, _, err := r.List(ctx, parentResourceID, nil)
 	assert.Nil(t, err)
@@ -56,33 +56,33 @@ func TestRoleBuilderList(t *testing.T) {
 	t.Logf("Amount of roles obtained: %d", len(res))
 }
 
-func TestUserBuilderGrants(t *testing.T) {
+func TestRoleBuilderGrants(t *testing.T) {
 	c := initClient(t)
 
-	u := newUserBuilder(c)
+	r := newRoleBuilder(c, newSafeguard(c, "admin", nil))
 
-	// First get users
-	users, _, _, err := u.List(ctx, parentResourceID, nil)
+	// First get roles
+	roles, _, _, err := r.List(ctx, parentResourceID, nil)
 	assert.Nil(t, err)
-	assert.NotNil(t, users)
+	assert.NotNil(t, roles)
 
-	if len(users) == 0 {
-		t.Skip("No users found to test grants")
+	if len(roles) == 0 {
+		t.Skip("No roles found to test grants")
 	}
 
-	// Test grants for the first user
-	user := users[0]
-	grants, _, _, err := u.Grants(ctx, user, nil)
-	assert.Nil(t, err)
-	assert.NotNil(t, grants)
+	// Test grants for every role, which share a single listing of users and roles
+	for _, role := range roles {
+		grants, _, _, err := r.Grants(ctx, role, nil)
+		assert.Nil(t, err)
 
-	t.Logf("Amount of grants for user %s: %d", user.DisplayName, len(grants))
+		t.Logf("Amount of grants for role %s: %d", role.DisplayName, len(grants))
+	}
 }
 
 func TestRoleBuilderEntitlements(t *testing.T) {
 	c := initClient(t)
 
-	r := newRoleBuilder(c)
+	r := newRoleBuilder(c, newSafeguard(c, "admin", nil))
 
 	// First get roles
 	roles, _, _, err := r.List(ctx, parentResourceID, nil)
@@ -0,0 +1,377 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+var (
+	// securityNamePattern is the pattern Nexus requires for the names of privileges and other security objects.
+	securityNamePattern = regexp.MustCompile(`^[a-zA-Z0-9\-][a-zA-Z0-9_\-.]*$`)
+	// repositoryFormatPattern matches repository format names such as maven2, npm or gitlfs.
+	repositoryFormatPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+type privilegeBuilder struct {
+	client *client.APIClient
+	guard  *safeguard
+}
+
+func (o *privilegeBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return privilegeResourceType
+}
+
+// List returns all the privileges from Nexus as resource objects.
+func (o *privilegeBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	privileges, annos, err := o.client.ListPrivileges(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	for _, privilege := range privileges {
+		privilegeResource, err := privilegeToResource(privilege)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		resources = append(resources, privilegeResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+// Entitlements returns the entitlement that roles hold when they include the privilege.
+func (o *privilegeBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var entitlements []*v2.Entitlement
+
+	opts := []entitlement.EntitlementOption{
+		entitlement.WithGrantableTo(roleResourceType),
+		entitlement.WithDescription(fmt.Sprintf("Roles that include privilege: %s", resource.DisplayName)),
+		entitlement.WithDisplayName(fmt.Sprintf("Privilege: %s", resource.DisplayName)),
+	}
+
+	entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, assignedEntitlement, opts...))
+	return entitlements, "", nil, nil
+}
+
+// Grants returns a grant for every role that includes the privilege.
+// Grants are expandable so that holders of the role are shown as holding the privilege as well.
+func (o *privilegeBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	privilegeID := resource.Id.Resource
+
+	roles, err := o.client.RolesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var grants []*v2.Grant
+	for _, role := range roles {
+		if !slices.Contains(role.Privileges, privilegeID) {
+			continue
+		}
+
+		g := grant.NewGrant(
+			resource,
+			assignedEntitlement,
+			roleResourceID(role.ID),
+			grant.WithAnnotation(roleExpandable(role.ID)),
+		)
+		grants = append(grants, g)
+	}
+
+	return grants, "", nil, nil
+}
+
+func newPrivilegeBuilder(client *client.APIClient, guard *safeguard) *privilegeBuilder {
+	return &privilegeBuilder{
+		client: client,
+		guard:  guard,
+	}
+}
+
+// Grant adds the privilege to a custom role. Built-in and read-only roles, and roles from other sources, are refused.
+func (o *privilegeBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	if principal.Id.ResourceType != roleResourceType.Id {
+		return nil, fmt.Errorf("baton-sonatype-nexus: only roles can be granted privileges")
+	}
+
+	privilegeID := entitlement.Resource.Id.Resource
+
+	changed, err := updateRole(ctx, o.client, principal.Id.Resource, func(role *client.Role) (bool, error) {
+		if slices.Contains(role.Privileges, privilegeID) {
+			return false, nil
+		}
+		role.Privileges = append(role.Privileges, privilegeID)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	}
+
+	return nil, nil
+}
+
+// Revoke removes the privilege from a custom role. Built-in and read-only roles, roles from other sources and
+// revokes that leave Nexus without an active administrator are refused.
+func (o *privilegeBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	if grant.Principal.Id.ResourceType != roleResourceType.Id {
+		return nil, fmt.Errorf("baton-sonatype-nexus: only roles can be revoked privileges")
+	}
+
+	privilegeID := grant.Entitlement.Resource.Id.Resource
+
+	changed, err := updateRole(ctx, o.client, grant.Principal.Id.Resource, func(role *client.Role) (bool, error) {
+		if !slices.Contains(role.Privileges, privilegeID) {
+			return false, nil
+		}
+		role.Privileges = slices.DeleteFunc(role.Privileges, func(p string) bool { return p == privilegeID })
+		err := o.guard.checkRoleChange(ctx, role.ID, role)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	return nil, nil
+}
+
+// Create creates a privilege from the role trait profile of the resource, read with the same keys the privilege
+// syncer emits: name, type, description, format, repository, content_selector, actions and pattern.
+// Only repository-view, repository-admin, repository-content-selector and wildcard privileges can be created.
+func (o *privilegeBuilder) Create(ctx context.Context, res *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	if res.GetId().GetResourceType() != "" && res.GetId().GetResourceType() != privilegeResourceType.Id {
+		return nil, nil, fmt.Errorf("baton-sonatype-nexus: non-privilege resource passed to privilege create")
+	}
+
+	privilegeType, payload, err := privilegePayload(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = o.validatePrivilege(ctx, privilegeType, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	annos, err := o.client.CreatePrivilege(ctx, privilegeType, payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create privilege: %w", err)
+	}
+
+	privilegeResource, err := privilegeToResource(client.Privilege{
+		Type:            privilegeType,
+		Name:            payload.Name,
+		Description:     payload.Description,
+		Format:          payload.Format,
+		Repository:      payload.Repository,
+		ContentSelector: payload.ContentSelector,
+		Pattern:         payload.Pattern,
+		Actions:         payload.Actions,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privilegeResource, annos, nil
+}
+
+// Delete deletes a privilege. Privileges Nexus marks read-only, such as the built-in privileges, are refused.
+func (o *privilegeBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	if resourceId.ResourceType != privilegeResourceType.Id {
+		return nil, fmt.Errorf("baton-sonatype-nexus: non-privilege resource passed to privilege delete")
+	}
+
+	privileges, _, err := o.client.ListPrivileges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list privileges: %w", err)
+	}
+
+	existing := slices.IndexFunc(privileges, func(p client.Privilege) bool { return p.Name == resourceId.Resource })
+	if existing < 0 {
+		return nil, fmt.Errorf("baton-sonatype-nexus: privilege %s not found", resourceId.Resource)
+	}
+	if privileges[existing].ReadOnly {
+		return nil, fmt.Errorf("baton-sonatype-nexus: privilege %s is read-only in Nexus and cannot be deleted", resourceId.Resource)
+	}
+
+	annos, err := o.client.DeletePrivilege(ctx, resourceId.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete privilege: %w", err)
+	}
+
+	return annos, nil
+}
+
+// privilegePayload reads the type and the fields of the privilege to create from the role trait profile of a resource.
+// Only the fields used by the privilege type are kept, and actions are sent in upper case like Nexus lists them.
+func privilegePayload(res *v2.Resource) (string, *client.PrivilegePayload, error) {
+	roleTrait, err := resource.GetRoleTrait(res)
+	if err != nil {
+		return "", nil, fmt.Errorf("baton-sonatype-nexus: privilege create requires a role trait: %w", err)
+	}
+	profile := roleTrait.GetProfile().AsMap()
+
+	name, _ := profile["name"].(string)
+	if name == "" {
+		name = res.GetId().GetResource()
+	}
+
+	privilegeType, _ := profile["type"].(string)
+	description, _ := profile["description"].(string)
+	payload := &client.PrivilegePayload{
+		Name:        name,
+		Description: description,
+	}
+
+	switch privilegeType {
+	case privilegeTypeRepositoryView, privilegeTypeRepositoryAdmin, privilegeTypeContentSelector:
+		payload.Format, _ = profile["format"].(string)
+		payload.Repository, _ = profile["repository"].(string)
+		if privilegeType == privilegeTypeContentSelector {
+			payload.ContentSelector, _ = profile["content_selector"].(string)
+		}
+
+		actions, err := profileStringList(profile, "actions")
+		if err != nil {
+			return "", nil, err
+		}
+		for _, action := range actions {
+			payload.Actions = append(payload.Actions, strings.ToUpper(action))
+		}
+	case privilegeTypeWildcard:
+		payload.Pattern, _ = profile["pattern"].(string)
+	case "":
+		return "", nil, fmt.Errorf("missing or invalid 'type' in profile")
+	default:
+		return "", nil, fmt.Errorf(
+			"baton-sonatype-nexus: cannot create %s privileges, expected one of %s, %s, %s or %s",
+			privilegeType, privilegeTypeRepositoryView, privilegeTypeRepositoryAdmin, privilegeTypeContentSelector, privilegeTypeWildcard,
+		)
+	}
+
+	return privilegeType, payload, nil
+}
+
+// validatePrivilege checks a privilege before it is created.
+func (o *privilegeBuilder) validatePrivilege(ctx context.Context, privilegeType string, payload *client.PrivilegePayload) error {
+	if !securityNamePattern.MatchString(payload.Name) {
+		return fmt.Errorf("baton-sonatype-nexus: invalid privilege name %q, use letters, digits, '-', '_' and '.' only", payload.Name)
+	}
+
+	privileges, _, err := o.client.ListPrivileges(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list privileges: %w", err)
+	}
+	if slices.ContainsFunc(privileges, func(p client.Privilege) bool { return p.Name == payload.Name }) {
+		return fmt.Errorf("baton-sonatype-nexus: privilege %s already exists", payload.Name)
+	}
+
+	if privilegeType == privilegeTypeWildcard {
+		if strings.TrimSpace(payload.Pattern) == "" {
+			return fmt.Errorf("baton-sonatype-nexus: wildcard privilege %s requires a pattern", payload.Name)
+		}
+		for _, part := range parseWildcardPermission(payload.Pattern) {
+			if len(part) == 0 {
+				return fmt.Errorf("baton-sonatype-nexus: invalid wildcard pattern %q, every part must hold a value", payload.Pattern)
+			}
+		}
+		return nil
+	}
+
+	if payload.Format != wildcardToken && !repositoryFormatPattern.MatchString(payload.Format) {
+		return fmt.Errorf("baton-sonatype-nexus: invalid repository format %q, use * or a format such as maven2", payload.Format)
+	}
+
+	if payload.Repository == "" {
+		return fmt.Errorf("baton-sonatype-nexus: %s privilege %s requires a repository, use * for all repositories", privilegeType, payload.Name)
+	}
+	if payload.Repository != wildcardToken {
+		repositories, _, err := o.client.ListRepositories(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list repositories: %w", err)
+		}
+
+		index := slices.IndexFunc(repositories, func(r client.Repository) bool { return r.Name == payload.Repository })
+		if index < 0 {
+			return fmt.Errorf("baton-sonatype-nexus: unknown repository %s", payload.Repository)
+		}
+		if repositories[index].Format != payload.Format {
+			return fmt.Errorf(
+				"baton-sonatype-nexus: repository %s has format %s, but the privilege is for format %s",
+				payload.Repository, repositories[index].Format, payload.Format,
+			)
+		}
+	}
+
+	if len(payload.Actions) == 0 {
+		return fmt.Errorf("baton-sonatype-nexus: %s privilege %s requires at least one action", privilegeType, payload.Name)
+	}
+	for _, action := range payload.Actions {
+		if action != "ALL" && !slices.Contains(repositoryActions, strings.ToLower(action)) {
+			return fmt.Errorf("baton-sonatype-nexus: invalid action %s, expected ALL or one of %s", action, strings.ToUpper(strings.Join(repositoryActions, ", ")))
+		}
+	}
+
+	if privilegeType == privilegeTypeContentSelector && payload.ContentSelector == "" {
+		return fmt.Errorf("baton-sonatype-nexus: %s privilege %s requires a content selector", privilegeType, payload.Name)
+	}
+
+	return nil
+}
+
+func privilegeToResource(privilege client.Privilege) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":             privilege.Name,
+		"type":             privilege.Type,
+		"description":      privilege.Description,
+		"read_only":        privilege.ReadOnly,
+		"domain":           privilege.Domain,
+		"format":           privilege.Format,
+		"repository":       privilege.Repository,
+		"content_selector": privilege.ContentSelector,
+		"script_name":      privilege.ScriptName,
+		"pattern":          privilege.Pattern,
+		"actions":          toInterfaceSlice(privilege.Actions),
+	}
+
+	privilegeTraits := []resource.RoleTraitOption{
+		resource.WithRoleProfile(profile),
+	}
+
+	privilegeResource, err := resource.NewRoleResource(
+		privilege.Name,
+		privilegeResourceType,
+		privilege.Name,
+		privilegeTraits,
+		resource.WithDescription(privilege.Description),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating privilege resource: %w", err)
+	}
+
+	return privilegeResource, nil
+}
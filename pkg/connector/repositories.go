@@ -0,0 +1,184 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+// repositoryActions are the repository-view privilege actions, in the order they are exposed as entitlements.
+var repositoryActions = []string{"browse", "read", "add", "edit", "delete"}
+
+var repositoryActionDescriptions = map[string]string{
+	"browse": "Browse the contents of repository: %s",
+	"read":   "Read components from repository: %s",
+	"add":    "Add (deploy) components to repository: %s",
+	"edit":   "Edit components in repository: %s",
+	"delete": "Delete components from repository: %s",
+}
+
+type repositoryBuilder struct {
+	client *client.APIClient
+}
+
+func (o *repositoryBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return repositoryResourceType
+}
+
+// List returns all the repositories from Nexus as resource objects.
+func (o *repositoryBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	repositories, annos, err := o.client.ListRepositories(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	for _, repository := range repositories {
+		blobStore := ""
+		if repository.Storage != nil {
+			blobStore = repository.Storage.BlobStoreName
+		}
+
+		profile := map[string]interface{}{
+			"name":       repository.Name,
+			"format":     repository.Format,
+			"type":       repository.Type,
+			"url":        repository.URL,
+			"blob_store": blobStore,
+		}
+		if repository.Online != nil {
+			profile["online"] = *repository.Online
+		}
+
+		repositoryTraits := []resource.AppTraitOption{
+			resource.WithAppProfile(profile),
+		}
+
+		repositoryResource, err := resource.NewAppResource(
+			repository.Name,
+			repositoryResourceType,
+			repository.Name,
+			repositoryTraits,
+			resource.WithDescription(fmt.Sprintf("%s %s repository", repository.Format, repository.Type)),
+		)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating repository resource: %w", err)
+		}
+
+		resources = append(resources, repositoryResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+// Entitlements returns an entitlement for each repository-view action on the repository.
+func (o *repositoryBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var entitlements []*v2.Entitlement
+
+	for _, action := range repositoryActions {
+		opts := []entitlement.EntitlementOption{
+			entitlement.WithGrantableTo(roleResourceType),
+			entitlement.WithDescription(fmt.Sprintf(repositoryActionDescriptions[action], resource.DisplayName)),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, action)),
+		}
+
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, action, opts...))
+	}
+
+	return entitlements, "", nil, nil
+}
+
+// Grants returns the effective repository access of every role, computed by expanding the
+// repository-view, content selector and wildcard privileges of the role against the repository.
+// Grants are expandable so that holders of the role are shown with the same repository access.
+func (o *repositoryBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	repository, err := repositoryFromResource(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	roles, err := o.client.RolesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	privileges, err := o.client.PrivilegesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	evaluator := newPrivilegeEvaluator(privileges)
+
+	var grants []*v2.Grant
+	for _, role := range roles {
+		grants = append(grants, repositoryGrantsForRole(resource, repository, role, evaluator)...)
+	}
+
+	return grants, "", nil, nil
+}
+
+// repositoryGrantsForRole returns a grant for each repository action the role's own privileges allow.
+// The grant metadata lists the privileges that allow the action, and whether access is limited to
+// the content matched by content selectors.
+func repositoryGrantsForRole(resource *v2.Resource, repository client.Repository, role client.Role, evaluator *privilegeEvaluator) []*v2.Grant {
+	grantedBy := make(map[string][]string)
+	unrestricted := make(map[string]bool)
+	for _, privilegeName := range role.Privileges {
+		for _, action := range evaluator.repositoryActions(privilegeName, repository) {
+			grantedBy[action] = append(grantedBy[action], privilegeName)
+			if !evaluator.isContentSelector(privilegeName) {
+				unrestricted[action] = true
+			}
+		}
+	}
+
+	var grants []*v2.Grant
+	for _, action := range repositoryActions {
+		privilegeNames, ok := grantedBy[action]
+		if !ok {
+			continue
+		}
+
+		g := grant.NewGrant(
+			resource,
+			action,
+			roleResourceID(role.ID),
+			grant.WithAnnotation(roleExpandable(role.ID)),
+			grant.WithGrantMetadata(map[string]interface{}{
+				"privileges":            toInterfaceSlice(privilegeNames),
+				"content_selector_only": !unrestricted[action],
+			}),
+		)
+		grants = append(grants, g)
+	}
+
+	return grants
+}
+
+// repositoryFromResource recovers the repository name and format from a synced repository resource.
+func repositoryFromResource(r *v2.Resource) (client.Repository, error) {
+	appTrait, err := resource.GetAppTrait(r)
+	if err != nil {
+		return client.Repository{}, fmt.Errorf("error getting repository trait: %w", err)
+	}
+
+	format, _ := appTrait.GetProfile().AsMap()["format"].(string)
+
+	return client.Repository{
+		Name:   r.Id.Resource,
+		Format: format,
+	}, nil
+}
+
+func newRepositoryBuilder(client *client.APIClient) *repositoryBuilder {
+	return &repositoryBuilder{
+		client: client,
+	}
+}
@@ -4,6 +4,30 @@ import (
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 )
 
+// assignedEntitlement is the entitlement slug used for role membership and role-to-privilege grants.
+const assignedEntitlement = "assigned"
+
+// defaultUserSource is the source of users stored in Nexus itself, as opposed to LDAP, SAML or Crowd.
+const defaultUserSource = "default"
+
+// Statuses of a Nexus user.
+const (
+	userStatusActive         = "active"
+	userStatusDisabled       = "disabled"
+	userStatusLocked         = "locked"
+	userStatusChangePassword = "changepassword"
+)
+
+// Ways users are deprovisioned.
+const (
+	deleteModeDelete               = "delete"
+	deleteModeDisable              = "disable"
+	deleteModeDisableAndStripRoles = "disable-and-strip-roles"
+)
+
+// systemUserIDs are the accounts built into Nexus.
+var systemUserIDs = []string{"admin", "anonymous"}
+
 // The user resource type is for all user objects from the database.
 var userResourceType = &v2.ResourceType{
 	Id:          "user",
@@ -11,6 +35,23 @@ var userResourceType = &v2.ResourceType{
 	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
 }
 
+// The user source resource type groups users by the realm they come from, such as default, LDAP, SAML or Crowd.
+var userSourceResourceType = &v2.ResourceType{
+	Id:          "user_source",
+	DisplayName: "User Source",
+	Description: "A user source in Nexus",
+}
+
+// The group resource type is for LDAP groups, which Nexus maps to the role whose ID matches the group name.
+var groupResourceType = &v2.ResourceType{
+	Id:          "group",
+	DisplayName: "Group",
+	Description: "An LDAP group mapped to Nexus roles",
+	Traits: []v2.ResourceType_Trait{
+		v2.ResourceType_TRAIT_GROUP,
+	},
+}
+
 var roleResourceType = &v2.ResourceType{
 	Id:          "role",
 	DisplayName: "Role",
@@ -19,3 +60,30 @@ var roleResourceType = &v2.ResourceType{
 		v2.ResourceType_TRAIT_ROLE,
 	},
 }
+
+var privilegeResourceType = &v2.ResourceType{
+	Id:          "privilege",
+	DisplayName: "Privilege",
+	Description: "A privilege in Nexus",
+	Traits: []v2.ResourceType_Trait{
+		v2.ResourceType_TRAIT_ROLE,
+	},
+}
+
+var repositoryResourceType = &v2.ResourceType{
+	Id:          "repository",
+	DisplayName: "Repository",
+	Description: "A repository in Nexus",
+	Traits: []v2.ResourceType_Trait{
+		v2.ResourceType_TRAIT_APP,
+	},
+}
+
+var contentSelectorResourceType = &v2.ResourceType{
+	Id:          "content_selector",
+	DisplayName: "Content Selector",
+	Description: "A content selector in Nexus, matching repository content with a CSEL expression",
+	Traits: []v2.ResourceType_Trait{
+		v2.ResourceType_TRAIT_APP,
+	},
+}
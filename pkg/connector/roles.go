@@ -3,52 +3,63 @@ package connector
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	"github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// roleUpdateAttempts bounds how often a role update overwritten by another client is applied again.
+	roleUpdateAttempts = 3
+	// roleUpdateRetryDelay is the delay before the second attempt, growing linearly with further attempts.
+	roleUpdateRetryDelay = 100 * time.Millisecond
 )
 
 type roleBuilder struct {
 	client *client.APIClient
+	guard  *safeguard
 }
 
 func (o *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return roleResourceType
 }
 
+// List returns all roles as resource objects, and logs the nested roles that close a cycle,
+// which the grants of every role leave out.
 func (o *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
 	roles, annos, err := o.client.ListRoles(ctx)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
+	_, cycles := nestedRoleGraph(roles)
+	for _, cycle := range cycles {
+		l.Warn(
+			"baton-sonatype-nexus: ignoring nested role that creates a cycle",
+			zap.String("role_id", cycle.roleID),
+			zap.String("nested_role_id", cycle.nestedRoleID),
+		)
+	}
+
 	var resources []*v2.Resource
 	for _, role := range roles {
-		profile := map[string]interface{}{
-			"role_id":     role.ID,
-			"source":      role.Source,
-			"description": role.Description,
-			"name":        role.Name,
-		}
-
-		roleTraits := []resource.RoleTraitOption{
-			resource.WithRoleProfile(profile),
-		}
-
-		roleResource, err := resource.NewRoleResource(
-			role.ID,
-			roleResourceType,
-			role.Name,
-			roleTraits,
-		)
+		roleResource, err := roleToResource(role)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("error creating role resource: %w", err)
+			return nil, "", nil, err
 		}
 
 		resources = append(resources, roleResource)
@@ -57,121 +68,696 @@ func (o *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 	return resources, "", annos, nil
 }
 
+func roleToResource(role client.Role) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"role_id":     role.ID,
+		"source":      role.Source,
+		"description": role.Description,
+		"name":        role.Name,
+		"read_only":   role.ReadOnly,
+		"privileges":  toInterfaceSlice(role.Privileges),
+		"roles":       toInterfaceSlice(role.Roles),
+	}
+
+	roleTraits := []resource.RoleTraitOption{
+		resource.WithRoleProfile(profile),
+	}
+
+	roleResource, err := resource.NewRoleResource(
+		role.Name,
+		roleResourceType,
+		role.ID,
+		roleTraits,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating role resource: %w", err)
+	}
+
+	return roleResource, nil
+}
+
 func (o *roleBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	var entitlements []*v2.Entitlement
 
 	opts := []entitlement.EntitlementOption{
-		entitlement.WithGrantableTo(userResourceType),
+		entitlement.WithGrantableTo(userResourceType, roleResourceType),
 		entitlement.WithDescription(fmt.Sprintf("Membership to role: %s", resource.DisplayName)),
 		entitlement.WithDisplayName(fmt.Sprintf("Role: %s", resource.DisplayName)),
 	}
 
-	entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, "assigned", opts...))
+	entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, assignedEntitlement, opts...))
 	return entitlements, "", nil, nil
 }
 
+// Grants returns a grant for every user holding this role and for every role that contains it.
+// Roles a user holds only through an LDAP or SAML mapping are marked immutable, since they are
+// managed by the directory. A role mapped from an LDAP group is granted to the group instead,
+// immutable and expandable to its members, so that access inherited from a directory group can be told apart
+// from a direct assignment. Nested role grants are expandable so that holders of the containing
+// role are shown as holding the nested role as well.
 func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	roleId := resource.Id.Resource
+
+	users, err := o.client.UsersSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	roles, err := o.client.RolesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	groups, err := ldapGroups(ctx, o.client)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	mappedGroup := slices.ContainsFunc(groups, func(g ldapGroup) bool {
+		return g.mappedRole != nil && g.mappedRole.ID == roleId
+	})
+
+	var grants []*v2.Grant
+	if mappedGroup {
+		groupResource := &v2.ResourceId{
+			ResourceType: groupResourceType.Id,
+			Resource:     roleId,
+		}
+		grants = append(grants, grant.NewGrant(
+			resource,
+			assignedEntitlement,
+			groupResource,
+			grant.WithAnnotation(groupExpandable(roleId)),
+			grant.WithAnnotation(&v2.GrantImmutable{SourceId: client.LDAPUserSource}),
+		))
+	}
+
+	for _, user := range users {
+		userResource := userResourceID(user)
+
+		switch {
+		case slices.Contains(user.Roles, roleId):
+			grants = append(grants, grant.NewGrant(resource, assignedEntitlement, userResource))
+		case mappedGroup && user.Source == client.LDAPUserSource:
+			// Membership is shown through the LDAP group.
+		case slices.Contains(user.ExternalRoles, roleId):
+			grants = append(grants, grant.NewGrant(
+				resource,
+				assignedEntitlement,
+				userResource,
+				grant.WithAnnotation(&v2.GrantImmutable{SourceId: user.Source}),
+			))
+		}
+	}
+
+	nested, _ := nestedRoleGraph(roles)
+	for _, role := range roles {
+		if !slices.Contains(nested[role.ID], roleId) {
+			continue
+		}
+
+		g := grant.NewGrant(
+			resource,
+			assignedEntitlement,
+			roleResourceID(role.ID),
+			grant.WithAnnotation(roleExpandable(role.ID)),
+		)
+		grants = append(grants, g)
+	}
+
+	return grants, "", nil, nil
+}
+
+// roleNesting is a role nested inside another role.
+type roleNesting struct {
+	roleID       string
+	nestedRoleID string
+}
+
+// nestedRoleGraph returns the roles nested inside each role, keyed by the containing role.
+// Nexus accepts roles that (directly or indirectly) contain themselves, so any nesting that
+// would close a cycle is dropped instead of being emitted as an expandable grant, and returned
+// as the second result.
+func nestedRoleGraph(roles []client.Role) (map[string][]string, []roleNesting) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	children := make(map[string][]string, len(roles))
+	roleIds := make([]string, 0, len(roles))
+	for _, role := range roles {
+		children[role.ID] = role.Roles
+		roleIds = append(roleIds, role.ID)
+	}
+	slices.Sort(roleIds)
+
+	graph := make(map[string][]string, len(roles))
+	state := make(map[string]int, len(roles))
+	var cycles []roleNesting
+
+	var visit func(roleId string)
+	visit = func(roleId string) {
+		state[roleId] = visiting
+		for _, child := range children[roleId] {
+			switch state[child] {
+			case visiting:
+				cycles = append(cycles, roleNesting{roleID: roleId, nestedRoleID: child})
+				continue
+			case unvisited:
+				visit(child)
+			}
+			graph[roleId] = append(graph[roleId], child)
+		}
+		state[roleId] = visited
+	}
+
+	for _, roleId := range roleIds {
+		if state[roleId] == unvisited {
+			visit(roleId)
+		}
+	}
+
+	return graph, cycles
 }
 
-func newRoleBuilder(client *client.APIClient) *roleBuilder {
+func newRoleBuilder(client *client.APIClient, guard *safeguard) *roleBuilder {
 	return &roleBuilder{
 		client: client,
+		guard:  guard,
 	}
 }
 
 func (o *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
-	if principal.Id.ResourceType != userResourceType.Id {
+	roleId := entitlement.Resource.Id.Resource
+
+	switch principal.Id.ResourceType {
+	case userResourceType.Id:
+	case roleResourceType.Id:
+		return o.grantNestedRole(ctx, principal.Id.Resource, roleId)
+	default:
 		l.Warn(
-			"baton-sonatype-nexus: only users can be granted roles",
+			"baton-sonatype-nexus: only users and roles can be granted roles",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-sonatype-nexus: only users can be granted roles")
+		return nil, fmt.Errorf("baton-sonatype-nexus: only users and roles can be granted roles")
 	}
 
-	userId := principal.Id.Resource
-	roleId := entitlement.Resource.Id.Resource
+	// Add the new role to the user's roles. For LDAP, SAML and Crowd users this adds a
+	// Nexus-side role mapping on top of the roles mapped from the directory.
+	userId, source := principalUser(principal)
+	changed, err := updateUserRoles(ctx, o.client, userId, source, func(user *client.User) ([]string, bool, error) {
+		if slices.Contains(user.Roles, roleId) {
+			return nil, false, nil
+		}
+		return append(slices.Clone(user.Roles), roleId), true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	}
+
+	return nil, nil
+}
+
+func (o *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	roleId := grant.Entitlement.Resource.Id.Resource
 
-	users, _, err := o.client.ListUsersByID(ctx, userId)
+	switch grant.Principal.Id.ResourceType {
+	case userResourceType.Id:
+	case roleResourceType.Id:
+		return o.revokeNestedRole(ctx, grant.Principal.Id.Resource, roleId)
+	default:
+		l.Warn(
+			"baton-sonatype-nexus: only roles of users and roles can be revoked",
+			zap.String("principal_type", grant.Principal.Id.ResourceType),
+			zap.String("principal_id", grant.Principal.Id.Resource),
+		)
+		return nil, fmt.Errorf("baton-sonatype-nexus: only roles of users and roles can be revoked")
+	}
+
+	userId, source := principalUser(grant.Principal)
+	changed, err := updateUserRoles(ctx, o.client, userId, source, func(user *client.User) ([]string, bool, error) {
+		if !slices.Contains(user.Roles, roleId) && slices.Contains(user.ExternalRoles, roleId) {
+			return nil, false, fmt.Errorf(
+				"baton-sonatype-nexus: role %s of user %s is managed in LDAP/SAML (source %s), revoke it in the directory instead",
+				roleId, userId, user.Source,
+			)
+		}
+
+		if !slices.Contains(user.Roles, roleId) {
+			return nil, false, nil
+		}
+
+		newRoles := slices.DeleteFunc(slices.Clone(user.Roles), func(r string) bool { return r == roleId })
+		err := o.guard.checkRoleRevoke(ctx, user, newRoles)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return newRoles, true, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users by id: %w", err)
+		return nil, err
 	}
 
-	var targetUser *client.User
-	for _, u := range users {
-		if u.UserID == userId {
-			targetUser = u
-			break
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	return nil, nil
+}
+
+// Create creates a custom role from the role trait profile of the resource, read with the same keys the role
+// syncer emits: role_id, name, description, privileges and roles (the nested roles). A custom role with the same
+// ID is only replaced when the profile sets replace_existing. Roles from other sources and read-only roles are refused.
+func (o *roleBuilder) Create(ctx context.Context, res *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	if res.GetId().GetResourceType() != "" && res.GetId().GetResourceType() != roleResourceType.Id {
+		return nil, nil, fmt.Errorf("baton-sonatype-nexus: non-role resource passed to role create")
+	}
+
+	payload, replace, err := rolePayload(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roles, _, err := o.client.ListRoles(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	err = o.validateRolePayload(ctx, roles, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !slices.ContainsFunc(roles, func(r client.Role) bool { return r.ID == payload.ID }) {
+		createdRole, annos, err := o.client.CreateRole(ctx, payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create role: %w", err)
 		}
+
+		roleResource, err := roleToResource(*createdRole)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return roleResource, annos, nil
 	}
 
-	if targetUser == nil {
-		return nil, fmt.Errorf("user %s not found", userId)
+	if !replace {
+		return nil, nil, status.Errorf(codes.AlreadyExists, "baton-sonatype-nexus: role %s already exists, set replace_existing in the profile to replace it", payload.ID)
 	}
 
-	// Check if the user already has the role
-	for _, existingRole := range targetUser.Roles {
-		if existingRole == roleId {
-			return annotations.New(&v2.GrantAlreadyExists{}), nil
+	var replaced client.Role
+	_, err = updateRole(ctx, o.client, payload.ID, func(role *client.Role) (bool, error) {
+		role.Name = payload.Name
+		role.Description = payload.Description
+		role.Privileges = payload.Privileges
+		role.Roles = payload.Roles
+
+		err := o.guard.checkRoleChange(ctx, role.ID, role)
+		if err != nil {
+			return false, err
 		}
+
+		replaced = *role
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Add the new role to the user's roles
-	targetUser.Roles = append(targetUser.Roles, roleId)
+	roleResource, err := roleToResource(replaced)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return roleResource, nil, nil
+}
 
-	// Update the user in Nexus
-	_, err = o.client.UpdateUser(ctx, userId, targetUser)
+// Delete deletes a custom role. Roles from other sources, read-only roles and deletions that leave
+// Nexus without an active administrator are refused.
+func (o *roleBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	if resourceId.ResourceType != roleResourceType.Id {
+		return nil, fmt.Errorf("baton-sonatype-nexus: non-role resource passed to role delete")
+	}
+
+	roles, _, err := o.client.ListRoles(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user roles: %w", err)
+		return nil, fmt.Errorf("failed to list roles: %w", err)
 	}
 
-	return nil, nil
+	existing := slices.IndexFunc(roles, func(r client.Role) bool { return r.ID == resourceId.Resource })
+	if existing < 0 {
+		return nil, fmt.Errorf("baton-sonatype-nexus: role %s not found", resourceId.Resource)
+	}
+
+	err = checkRoleEditable(roles[existing])
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.guard.checkRoleChange(ctx, resourceId.Resource, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	annos, err := o.client.DeleteRole(ctx, resourceId.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return annos, nil
 }
 
-func (o *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
-	userId := grant.Principal.Id.Resource
-	roleId := grant.Entitlement.Resource.Id.Resource
+// rolePayload reads the role to create or update from the role trait profile of a resource.
+// It also reports whether the profile asks to replace an existing role, which requires both
+// the privileges and the nested roles to be set.
+func rolePayload(res *v2.Resource) (*client.RolePayload, bool, error) {
+	roleTrait, err := resource.GetRoleTrait(res)
+	if err != nil {
+		return nil, false, fmt.Errorf("baton-sonatype-nexus: role create requires a role trait: %w", err)
+	}
+	profile := roleTrait.GetProfile().AsMap()
 
-	users, _, err := o.client.ListUsersByID(ctx, userId)
+	roleID, _ := profile["role_id"].(string)
+	if roleID == "" {
+		roleID = res.GetId().GetResource()
+	}
+	if roleID == "" {
+		return nil, false, fmt.Errorf("missing or invalid 'role_id' in profile")
+	}
+
+	name, _ := profile["name"].(string)
+	if name == "" {
+		name = res.GetDisplayName()
+	}
+	if name == "" {
+		name = roleID
+	}
+
+	description, _ := profile["description"].(string)
+
+	privileges, err := profileStringList(profile, "privileges")
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users by id: %w", err)
+		return nil, false, err
 	}
 
-	var targetUser *client.User
-	for _, u := range users {
-		if u.UserID == userId {
-			targetUser = u
-			break
+	nestedRoles, err := profileStringList(profile, "roles")
+	if err != nil {
+		return nil, false, err
+	}
+
+	replace, _ := profile["replace_existing"].(bool)
+	_, hasPrivileges := profile["privileges"]
+	_, hasRoles := profile["roles"]
+	if replace && (!hasPrivileges || !hasRoles) {
+		return nil, false, fmt.Errorf("baton-sonatype-nexus: replacing role %s requires both 'privileges' and 'roles' in profile", roleID)
+	}
+
+	return &client.RolePayload{
+		ID:          roleID,
+		Name:        name,
+		Description: description,
+		Privileges:  privileges,
+		Roles:       nestedRoles,
+	}, replace, nil
+}
+
+// validateRolePayload checks that every privilege and nested role exists and that the role does not contain itself.
+func (o *roleBuilder) validateRolePayload(ctx context.Context, roles []client.Role, payload *client.RolePayload) error {
+	privileges, _, err := o.client.ListPrivileges(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list privileges: %w", err)
+	}
+
+	var unknown []string
+	for _, privilege := range payload.Privileges {
+		if !slices.ContainsFunc(privileges, func(p client.Privilege) bool { return p.Name == privilege }) {
+			unknown = append(unknown, privilege)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("baton-sonatype-nexus: unknown privileges: %s", strings.Join(unknown, ", "))
+	}
+
+	for _, nested := range payload.Roles {
+		if !slices.ContainsFunc(roles, func(r client.Role) bool { return r.ID == nested }) {
+			unknown = append(unknown, nested)
 		}
 	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("baton-sonatype-nexus: unknown roles: %s", strings.Join(unknown, ", "))
+	}
 
-	if targetUser == nil {
-		return nil, fmt.Errorf("user %s not found", userId)
+	if slices.Contains(effectiveRoles(roles, payload.Roles), payload.ID) {
+		return fmt.Errorf("baton-sonatype-nexus: role %s cannot contain itself through its nested roles", payload.ID)
 	}
 
-	found := false
-	newRoles := make([]string, 0, len(targetUser.Roles))
-	for _, r := range targetUser.Roles {
-		if r == roleId {
-			found = true
-			continue // we don't add it, so it's removed.
+	return nil
+}
+
+// checkRoleEditable refuses changes to roles that are not managed in Nexus itself, such as roles
+// mapped from LDAP groups, and to roles Nexus marks read-only, such as the built-in nx-admin.
+func checkRoleEditable(role client.Role) error {
+	if role.Source != defaultUserSource {
+		return fmt.Errorf("baton-sonatype-nexus: role %s comes from source %s, only roles of the default source can be changed", role.ID, role.Source)
+	}
+	if role.ReadOnly {
+		return fmt.Errorf("baton-sonatype-nexus: role %s is read-only in Nexus and cannot be changed", role.ID)
+	}
+	return nil
+}
+
+// grantNestedRole nests a role inside a custom parent role, so that holders of the parent role also hold it.
+// Nexus accepts roles that contain themselves, so a nesting that would close a cycle is refused.
+func (o *roleBuilder) grantNestedRole(ctx context.Context, parentID, roleID string) (annotations.Annotations, error) {
+	changed, err := updateRole(ctx, o.client, parentID, func(parent *client.Role) (bool, error) {
+		if slices.Contains(parent.Roles, roleID) {
+			return false, nil
 		}
-		newRoles = append(newRoles, r)
+
+		roles, _, err := o.client.ListRoles(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to list roles: %w", err)
+		}
+
+		if !slices.ContainsFunc(roles, func(r client.Role) bool { return r.ID == roleID }) {
+			return false, fmt.Errorf("baton-sonatype-nexus: unknown roles: %s", roleID)
+		}
+
+		if roleID == parentID || slices.Contains(effectiveRoles(roles, []string{roleID}), parentID) {
+			return false, fmt.Errorf("baton-sonatype-nexus: cannot nest role %s inside role %s, role %s already contains role %s", roleID, parentID, roleID, parentID)
+		}
+
+		parent.Roles = append(parent.Roles, roleID)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if !found {
-		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
 	}
 
-	targetUser.Roles = newRoles
+	return nil, nil
+}
 
-	_, err = o.client.UpdateUser(ctx, userId, targetUser)
+// revokeNestedRole removes a role nested inside a custom parent role.
+func (o *roleBuilder) revokeNestedRole(ctx context.Context, parentID, roleID string) (annotations.Annotations, error) {
+	changed, err := updateRole(ctx, o.client, parentID, func(parent *client.Role) (bool, error) {
+		if !slices.Contains(parent.Roles, roleID) {
+			return false, nil
+		}
+
+		parent.Roles = slices.DeleteFunc(parent.Roles, func(r string) bool { return r == roleID })
+		err := o.guard.checkRoleChange(ctx, parentID, parent)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user roles: %w", err)
+		return nil, err
+	}
+
+	if !changed {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
 	}
 
 	return nil, nil
 }
+
+// principalUser returns the user ID and the user source of a user principal. The source is empty when the
+// principal carries neither a qualified ID nor its source, in which case every source is searched for the user.
+func principalUser(principal *v2.Resource) (string, string) {
+	userID, source := parseUserResourceID(principal.GetId().GetResource())
+	if parent := principal.GetParentResourceId(); source == "" && parent.GetResourceType() == userSourceResourceType.Id {
+		source = parent.GetResource()
+	}
+	return userID, source
+}
+
+// updateUserRoles sets the Nexus-side roles of a user to the roles returned by change, which also reports
+// whether an update is needed at all. Nexus replaces the whole user on update, so updates of the same user
+// are serialized, and the roles are read back afterwards. When another client overwrote the update in the
+// meantime, change is applied again to the stored user. It reports whether the user was updated.
+func updateUserRoles(
+	ctx context.Context,
+	c *client.APIClient,
+	userID string,
+	source string,
+	change func(user *client.User) ([]string, bool, error),
+) (bool, error) {
+	unlock := c.LockUser(userID)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		user, err := lookupUser(ctx, c, userID, source)
+		if err != nil {
+			return false, err
+		}
+
+		roles, ok, err := change(user)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		_, err = c.UpdateUser(ctx, userID, userRolesPayload(user, roles))
+		if err != nil {
+			return false, fmt.Errorf("failed to update user roles: %w", err)
+		}
+
+		stored, err := lookupUser(ctx, c, userID, user.Source)
+		if err != nil {
+			return false, fmt.Errorf("failed to verify user roles: %w", err)
+		}
+
+		if sameIDs(stored.Roles, roles) {
+			return true, nil
+		}
+
+		if attempt == roleUpdateAttempts {
+			return false, fmt.Errorf(
+				"baton-sonatype-nexus: roles of user %s were changed concurrently, expected %v after the update but found %v",
+				userID, roles, stored.Roles,
+			)
+		}
+
+		ctxzap.Extract(ctx).Warn(
+			"baton-sonatype-nexus: roles of user were changed concurrently, retrying the update",
+			zap.String("user_id", userID),
+			zap.Strings("expected_roles", roles),
+			zap.Strings("stored_roles", stored.Roles),
+			zap.Int("attempt", attempt),
+		)
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(time.Duration(attempt) * roleUpdateRetryDelay):
+		}
+	}
+}
+
+// updateRole applies change to a copy of a custom role and stores the privileges and nested roles it ends up with.
+// change reports whether an update is needed at all. Like updateUserRoles, updates of the same role are serialized
+// and read back, and change is applied again to the stored role when another client overwrote the update.
+// Roles from other sources and read-only roles are refused. It reports whether the role was updated.
+func updateRole(ctx context.Context, c *client.APIClient, roleID string, change func(role *client.Role) (bool, error)) (bool, error) {
+	unlock := c.LockRole(roleID)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		role, _, err := c.GetRole(ctx, roleID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get role: %w", err)
+		}
+
+		err = checkRoleEditable(*role)
+		if err != nil {
+			return false, err
+		}
+
+		role.Privileges = slices.Clone(role.Privileges)
+		role.Roles = slices.Clone(role.Roles)
+		ok, err := change(role)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		_, err = c.UpdateRole(ctx, roleID, &client.RolePayload{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Privileges:  role.Privileges,
+			Roles:       role.Roles,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to update role: %w", err)
+		}
+
+		stored, _, err := c.GetRole(ctx, roleID)
+		if err != nil {
+			return false, fmt.Errorf("failed to verify role: %w", err)
+		}
+
+		if sameIDs(stored.Privileges, role.Privileges) && sameIDs(stored.Roles, role.Roles) {
+			return true, nil
+		}
+
+		if attempt == roleUpdateAttempts {
+			return false, fmt.Errorf(
+				"baton-sonatype-nexus: role %s was changed concurrently, expected privileges %v and roles %v after the update but found %v and %v",
+				roleID, role.Privileges, role.Roles, stored.Privileges, stored.Roles,
+			)
+		}
+
+		ctxzap.Extract(ctx).Warn(
+			"baton-sonatype-nexus: role was changed concurrently, retrying the update",
+			zap.String("role_id", roleID),
+			zap.Int("attempt", attempt),
+		)
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(time.Duration(attempt) * roleUpdateRetryDelay):
+		}
+	}
+}
+
+// sameIDs reports whether both lists hold the same IDs, in any order.
+func sameIDs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// userRolesPayload returns the update that sets the Nexus-side roles of a user.
+// Nexus stores the roles of LDAP, SAML and Crowd users as a mapping keyed by the user's source,
+// so the source must be sent unchanged and the roles mapped from the directory must be left out,
+// otherwise they would be copied into Nexus and outlive a change in the directory.
+func userRolesPayload(user *client.User, roles []string) *client.User {
+	return &client.User{
+		UserID:       user.UserID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		EmailAddress: user.EmailAddress,
+		Status:       user.Status,
+		Source:       user.Source,
+		Roles:        roles,
+	}
+}
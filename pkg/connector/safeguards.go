@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+// adminRoleID is the built-in role granting full administrative access to Nexus.
+const adminRoleID = "nx-admin"
+
+// connectorPrivileges are the privileges the connector account needs to sync users and roles and change user roles,
+// with the permission each of them grants.
+var connectorPrivileges = []struct {
+	name       string
+	permission []string
+}{
+	{"nx-users-read", []string{"nexus", "users", "read"}},
+	{"nx-users-update", []string{"nexus", "users", "update"}},
+	{"nx-roles-read", []string{"nexus", "roles", "read"}},
+	{"nx-privileges-read", []string{"nexus", "privileges", "read"}},
+}
+
+// safeguard refuses deprovisioning changes that would remove a protected account, lock the
+// connector out of Nexus or leave Nexus without an active administrator.
+type safeguard struct {
+	client    *client.APIClient
+	username  string
+	protected []string
+}
+
+// newSafeguard returns a safeguard protecting the given users in addition to the built-in accounts.
+func newSafeguard(client *client.APIClient, username string, protected []string) *safeguard {
+	return &safeguard{
+		client:    client,
+		username:  username,
+		protected: append(slices.Clone(systemUserIDs), protected...),
+	}
+}
+
+// checkUserRemoval is called before a user is deleted or disabled.
+func (s *safeguard) checkUserRemoval(ctx context.Context, userID string) error {
+	if userID == s.username {
+		return fmt.Errorf("baton-sonatype-nexus: refusing to delete or disable user %s, the connector authenticates as this user and would lock itself out", userID)
+	}
+
+	err := s.checkProtected(userID, "delete or disable")
+	if err != nil {
+		return err
+	}
+
+	user, err := lookupUser(ctx, s.client, userID, "")
+	if err != nil {
+		return err
+	}
+
+	return s.checkLastAdmin(ctx, user, nil)
+}
+
+// checkRoleRevoke is called before roles are revoked from a user, with the roles the user keeps afterwards.
+func (s *safeguard) checkRoleRevoke(ctx context.Context, user *client.User, remainingRoles []string) error {
+	err := s.checkProtected(user.UserID, "revoke roles from")
+	if err != nil {
+		return err
+	}
+
+	remainingRoles = append(slices.Clone(remainingRoles), user.ExternalRoles...)
+	if user.UserID == s.username {
+		err = s.checkLockout(ctx, remainingRoles)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.checkLastAdmin(ctx, user, remainingRoles)
+}
+
+func (s *safeguard) checkProtected(userID, action string) error {
+	if slices.Contains(s.protected, userID) {
+		return fmt.Errorf("baton-sonatype-nexus: refusing to %s user %s, it is a protected user, remove it from the protected user IDs to allow this", action, userID)
+	}
+
+	return nil
+}
+
+// checkLockout refuses a change that leaves the connector account with only remainingRoles when
+// these no longer grant the privileges the connector needs.
+func (s *safeguard) checkLockout(ctx context.Context, remainingRoles []string) error {
+	roles, evaluator, err := s.listRolesAndPrivileges(ctx)
+	if err != nil {
+		return err
+	}
+
+	granted := effectivePrivileges(roles, remainingRoles)
+
+	var missing []string
+	for _, required := range connectorPrivileges {
+		if !evaluator.impliesAny(granted, required.permission...) {
+			missing = append(missing, required.name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("baton-sonatype-nexus: refusing to revoke roles from user %s, the connector authenticates as this user and would lose %s",
+			s.username, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// checkLastAdmin refuses a change that leaves the user with only remainingRoles when the user
+// is the last active administrator. Users are only listed when the change takes administrative
+// access away from the user.
+func (s *safeguard) checkLastAdmin(ctx context.Context, user *client.User, remainingRoles []string) error {
+	roles, evaluator, err := s.listRolesAndPrivileges(ctx)
+	if err != nil {
+		return err
+	}
+
+	held := append(slices.Clone(user.Roles), user.ExternalRoles...)
+	if !isAdmin(roles, evaluator, held) || isAdmin(roles, evaluator, remainingRoles) {
+		return nil
+	}
+
+	users, err := s.client.ListAllUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	changedUsers := make([]*client.User, 0, len(users))
+	for _, u := range users {
+		if u.UserID == user.UserID && u.Source == user.Source {
+			u = &client.User{UserID: u.UserID, Status: u.Status, Roles: remainingRoles}
+		}
+		changedUsers = append(changedUsers, u)
+	}
+
+	if activeAdmins(roles, evaluator, users) > 0 && activeAdmins(roles, evaluator, changedUsers) == 0 {
+		return fmt.Errorf("baton-sonatype-nexus: refusing to change user %s, it is the last active user with administrative access (%s)", user.UserID, adminRoleID)
+	}
+
+	return nil
+}
+
+// checkRoleChange is called before a custom role is replaced by changed, or deleted when changed is nil.
+// It refuses the change when no active user would have administrative access anymore.
+// Users are only listed when the change takes administrative access away from the role.
+func (s *safeguard) checkRoleChange(ctx context.Context, roleID string, changed *client.Role) error {
+	roles, evaluator, err := s.listRolesAndPrivileges(ctx)
+	if err != nil {
+		return err
+	}
+
+	changedRoles := make([]client.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.ID == roleID {
+			if changed == nil {
+				continue
+			}
+			role = *changed
+		}
+		changedRoles = append(changedRoles, role)
+	}
+
+	if !isAdmin(roles, evaluator, []string{roleID}) || isAdmin(changedRoles, evaluator, []string{roleID}) {
+		return nil
+	}
+
+	users, err := s.client.ListAllUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	if activeAdmins(roles, evaluator, users) > 0 && activeAdmins(changedRoles, evaluator, users) == 0 {
+		return fmt.Errorf("baton-sonatype-nexus: refusing to change role %s, no active user would have administrative access (%s) afterwards", roleID, adminRoleID)
+	}
+
+	return nil
+}
+
+func (s *safeguard) listRolesAndPrivileges(ctx context.Context) ([]client.Role, *privilegeEvaluator, error) {
+	roles, _, err := s.client.ListRoles(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	privileges, _, err := s.client.ListPrivileges(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list privileges: %w", err)
+	}
+
+	return roles, newPrivilegeEvaluator(privileges), nil
+}
+
+// isAdmin reports whether the roles grant administrative access: the nx-admin role, directly or through
+// a nested role, or a privilege granting every Nexus permission, such as nx-all.
+func isAdmin(roles []client.Role, evaluator *privilegeEvaluator, roleIDs []string) bool {
+	if slices.Contains(effectiveRoles(roles, roleIDs), adminRoleID) {
+		return true
+	}
+	return evaluator.impliesAny(effectivePrivileges(roles, roleIDs), "nexus", wildcardToken)
+}
+
+// activeAdmins counts the users that can log in and have administrative access, directly, through a nested role
+// or through a directory mapping.
+func activeAdmins(roles []client.Role, evaluator *privilegeEvaluator, users []*client.User) int {
+	count := 0
+	for _, u := range users {
+		if u.Status == userStatusDisabled || u.Status == userStatusLocked {
+			continue
+		}
+		if isAdmin(roles, evaluator, append(slices.Clone(u.Roles), u.ExternalRoles...)) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,65 @@
+package connector
+
+import (
+	"context"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+type userSourceBuilder struct {
+	client *client.APIClient
+}
+
+func (o *userSourceBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return userSourceResourceType
+}
+
+// List returns the user sources configured in Nexus as resource objects. Users are listed as children of their source.
+func (o *userSourceBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	sources, err := o.client.UserSourcesSnapshot(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	for _, source := range sources {
+		displayName := source.Name
+		if displayName == "" {
+			displayName = source.ID
+		}
+
+		sourceResource, err := resource.NewResource(
+			displayName,
+			userSourceResourceType,
+			source.ID,
+			resource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: userResourceType.Id}),
+		)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		resources = append(resources, sourceResource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements always returns an empty slice for user sources.
+func (o *userSourceBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for user sources.
+func (o *userSourceBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newUserSourceBuilder(client *client.APIClient) *userSourceBuilder {
+	return &userSourceBuilder{
+		client: client,
+	}
+}
@@ -3,64 +3,56 @@ package connector
 import (
 	"context"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
-	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	"github.com/conductorone/baton-sdk/pkg/types/resource"
 
 	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
 )
 
 type userBuilder struct {
-	client *client.APIClient
+	client         *client.APIClient
+	opts           Options
+	passwordPolicy *passwordPolicy
+	guard          *safeguard
 }
 
 func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return userResourceType
 }
 
-// List returns all the users from the database as resource objects.
+// List returns the users of the parent user source as resource objects.
 func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	users, annos, err := o.client.ListUsers(ctx)
+	if parentResourceID == nil || parentResourceID.ResourceType != userSourceResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	users, err := o.client.UsersSnapshot(ctx)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
 	var resources []*v2.Resource
 	for _, user := range users {
-		displayName := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
-
-		profile := map[string]interface{}{
-			"user_id":    user.UserID,
-			"email":      user.EmailAddress,
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"status":     user.Status,
-			"source":     user.Source,
-		}
-
-		userTraits := []resource.UserTraitOption{
-			resource.WithUserProfile(profile),
-			resource.WithEmail(user.EmailAddress, true),
+		if user.Source != parentResourceID.Resource {
+			continue
 		}
 
-		userResource, err := resource.NewUserResource(
-			displayName,
-			userResourceType,
-			user.UserID,
-			userTraits,
-		)
+		userResource, err := o.userToResource(user)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("error creating user resource: %w", err)
+			return nil, "", nil, err
 		}
 
 		resources = append(resources, userResource)
 	}
 
-	return resources, "", annos, nil
+	return resources, "", nil, nil
 }
 
 // Entitlements always returns an empty slice for users.
@@ -68,54 +60,18 @@ func (o *userBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _
 	return nil, "", nil, nil
 }
 
-// Grants returns the roles assigned to a user as grants.
+// Grants always returns an empty slice for users.
+// Role membership is emitted by the role syncer, which shares a single listing of all users.
 func (o *userBuilder) Grants(ctx context.Context, res *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	userID := res.Id.Resource
-
-	users, _, err := o.client.ListUsers(ctx)
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	roles, _, err := o.client.ListRoles(ctx)
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	var user *client.User
-	for _, u := range users {
-		if u.UserID == userID {
-			user = u
-			break
-		}
-	}
-	if user == nil {
-		return nil, "", nil, nil
-	}
-
-	var grants []*v2.Grant
-	for _, role := range roles {
-		for _, userRoleID := range user.Roles {
-			if userRoleID == role.ID {
-				roleResource := &v2.Resource{
-					Id: &v2.ResourceId{
-						ResourceType: roleResourceType.Id,
-						Resource:     role.ID,
-					},
-				}
-				g := grant.NewGrant(roleResource, "assigned", res)
-				grants = append(grants, g)
-				break
-			}
-		}
-	}
-
-	return grants, "", nil, nil
+	return nil, "", nil, nil
 }
 
-func newUserBuilder(client *client.APIClient) *userBuilder {
+func newUserBuilder(client *client.APIClient, opts Options, passwordPolicy *passwordPolicy, guard *safeguard) *userBuilder {
 	return &userBuilder{
-		client: client,
+		client:         client,
+		opts:           opts,
+		passwordPolicy: passwordPolicy,
+		guard:          guard,
 	}
 }
 
@@ -164,12 +120,23 @@ func (o *userBuilder) CreateAccount(
 
 	status, ok := profile["status"].(string)
 	if !ok || status == "" {
-		status = "active"
+		status = userStatusActive
 	}
 
-	role := "nx-anonymous"
+	roles, err := profileStringList(profile, "roles")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(roles) == 0 {
+		roles = o.opts.DefaultRoles
+	}
 
-	generatedPassword, err := generateCredentials(credentialOptions)
+	err = o.validateRoles(ctx, roles)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	generatedPassword, err := o.passwordPolicy.generateCredentials(credentialOptions)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -181,7 +148,7 @@ func (o *userBuilder) CreateAccount(
 		EmailAddress: emailAddress,
 		Password:     generatedPassword,
 		Status:       status,
-		Roles:        []string{role},
+		Roles:        roles,
 	}
 
 	createdUser, annotations, err := o.client.CreateUser(ctx, payload)
@@ -210,6 +177,32 @@ func (o *userBuilder) CreateAccount(
 	return response, plaintextData, annotations, nil
 }
 
+// validateRoles checks that every role exists in Nexus.
+func (o *userBuilder) validateRoles(ctx context.Context, roleIds []string) error {
+	if len(roleIds) == 0 {
+		return fmt.Errorf("baton-sonatype-nexus: at least one role is required to create a user, request roles or configure default roles")
+	}
+
+	roles, _, err := o.client.ListRoles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	var unknown []string
+	for _, roleId := range roleIds {
+		if !slices.ContainsFunc(roles, func(r client.Role) bool { return r.ID == roleId }) {
+			unknown = append(unknown, roleId)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("baton-sonatype-nexus: unknown roles: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// userToResource returns the resource of a user.
 func (o *userBuilder) userToResource(user *client.User) (*v2.Resource, error) {
 	displayName := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
 
@@ -225,13 +218,24 @@ func (o *userBuilder) userToResource(user *client.User) (*v2.Resource, error) {
 	userTraits := []resource.UserTraitOption{
 		resource.WithUserProfile(profile),
 		resource.WithEmail(user.EmailAddress, true),
+		userStatus(user.Status),
+		resource.WithAccountType(o.accountType(user.UserID)),
+	}
+
+	source := user.Source
+	if source == "" {
+		source = defaultUserSource
 	}
 
 	userResource, err := resource.NewUserResource(
 		displayName,
 		userResourceType,
-		user.UserID,
+		userResourceID(user).Resource,
 		userTraits,
+		resource.WithParentResourceID(&v2.ResourceId{
+			ResourceType: userSourceResourceType.Id,
+			Resource:     source,
+		}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error creating user resource: %w", err)
@@ -240,14 +244,179 @@ func (o *userBuilder) userToResource(user *client.User) (*v2.Resource, error) {
 	return userResource, nil
 }
 
+// setUserStatus disables or enables a local user, keeping its roles. Enabling only changes disabled users,
+// so that users that must change their password keep that status. It reports whether the user changed.
+func setUserStatus(ctx context.Context, c *client.APIClient, userID, status string) (*client.User, bool, error) {
+	if userID == anonymousUserID {
+		return nil, false, fmt.Errorf("baton-sonatype-nexus: the built-in %s user cannot be disabled or enabled, change anonymous access in the Nexus security settings instead", anonymousUserID)
+	}
+
+	unlock := c.LockUser(userID)
+	defer unlock()
+
+	user, err := lookupUser(ctx, c, userID, "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	if user.Source != defaultUserSource {
+		return nil, false, fmt.Errorf(
+			"baton-sonatype-nexus: cannot change the status of user %s from source %s, only local (default source) users have a status in Nexus",
+			userID,
+			user.Source,
+		)
+	}
+
+	switch {
+	case status == userStatusDisabled && user.Status == userStatusDisabled:
+		return user, false, nil
+	case status == userStatusActive && user.Status != userStatusDisabled:
+		return user, false, nil
+	}
+
+	user.Status = status
+	_, err = c.UpdateUser(ctx, userID, userRolesPayload(user, user.Roles))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	return user, true, nil
+}
+
+// userStatus maps the status of a Nexus user onto the user trait. Locked users cannot authenticate, and users
+// that must change their password can still log in, so the original status is kept as the detail.
+func userStatus(status string) resource.UserTraitOption {
+	switch status {
+	case userStatusActive:
+		return resource.WithStatus(v2.UserTrait_Status_STATUS_ENABLED)
+	case userStatusDisabled:
+		return resource.WithStatus(v2.UserTrait_Status_STATUS_DISABLED)
+	case userStatusLocked:
+		return resource.WithDetailedStatus(v2.UserTrait_Status_STATUS_DISABLED, status)
+	case userStatusChangePassword:
+		return resource.WithDetailedStatus(v2.UserTrait_Status_STATUS_ENABLED, status)
+	}
+	return resource.WithDetailedStatus(v2.UserTrait_Status_STATUS_UNSPECIFIED, status)
+}
+
+// accountType classifies the built-in accounts as system accounts and the users matching
+// one of the configured service account patterns as service accounts.
+func (o *userBuilder) accountType(userID string) v2.UserTrait_AccountType {
+	if slices.Contains(systemUserIDs, userID) {
+		return v2.UserTrait_ACCOUNT_TYPE_SYSTEM
+	}
+
+	for _, pattern := range o.opts.ServiceAccountPatterns {
+		if ok, _ := path.Match(pattern, userID); ok {
+			return v2.UserTrait_ACCOUNT_TYPE_SERVICE
+		}
+	}
+
+	return v2.UserTrait_ACCOUNT_TYPE_HUMAN
+}
+
+// Delete deprovisions a user according to the configured delete mode. The soft modes keep the user
+// for audit purposes: the user is disabled first, so that it cannot act even if removing its roles fails.
 func (o *userBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
 	if resourceId.ResourceType != userResourceType.Id {
 		return nil, fmt.Errorf("baton-sonatype-nexus: non-user resource passed to user delete")
 	}
-	_, err := o.client.DeleteUser(ctx, resourceId.Resource)
+
+	userID, source := parseUserResourceID(resourceId.Resource)
+	if source != "" && source != defaultUserSource {
+		return nil, fmt.Errorf("baton-sonatype-nexus: cannot delete user %s from source %s, only local (default source) users can be deleted in Nexus", userID, source)
+	}
+
+	err := o.guard.checkUserRemoval(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.opts.DeleteMode {
+	case deleteModeDisable, deleteModeDisableAndStripRoles:
+		user, _, err := setUserStatus(ctx, o.client, userID, userStatusDisabled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to disable user: %w", err)
+		}
+
+		if o.opts.DeleteMode == deleteModeDisable {
+			return nil, nil
+		}
+
+		// Nexus rejects local users without roles, so the stripped user role is left in place of the roles.
+		stripped := []string{o.opts.StrippedUserRole}
+		_, err = updateUserRoles(ctx, o.client, user.UserID, user.Source, func(user *client.User) ([]string, bool, error) {
+			return stripped, !sameIDs(user.Roles, stripped), nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove roles of disabled user: %w", err)
+		}
+
+		return nil, nil
+	}
+
+	_, err = o.client.DeleteUser(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete user: %w", err)
 	}
 
 	return nil, nil
 }
+
+func (o *userBuilder) RotateCapabilityDetails(
+	_ context.Context,
+) (*v2.CredentialDetailsCredentialRotation, annotations.Annotations, error) {
+	return &v2.CredentialDetailsCredentialRotation{
+		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
+		},
+		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
+	}, nil, nil
+}
+
+// Rotate sets a new random password for a local Nexus user.
+// Users from other sources such as LDAP, SAML or Crowd are refused, since their passwords are managed by the directory.
+func (o *userBuilder) Rotate(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	credentialOptions *v2.CredentialOptions,
+) ([]*v2.PlaintextData, annotations.Annotations, error) {
+	if resourceId.ResourceType != userResourceType.Id {
+		return nil, nil, fmt.Errorf("baton-sonatype-nexus: non-user resource passed to credential rotation")
+	}
+
+	userId, source := parseUserResourceID(resourceId.Resource)
+
+	targetUser, err := lookupUser(ctx, o.client, userId, source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if targetUser.Source != defaultUserSource {
+		return nil, nil, fmt.Errorf(
+			"baton-sonatype-nexus: cannot rotate the password of user %s from source %s, only passwords of local (default source) users can be changed in Nexus",
+			userId,
+			targetUser.Source,
+		)
+	}
+
+	generatedPassword, err := o.passwordPolicy.generateCredentials(credentialOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	annos, err := o.client.ChangePassword(ctx, userId, generatedPassword)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to change password: %w", err)
+	}
+
+	plaintextData := []*v2.PlaintextData{
+		{
+			Name:        "password",
+			Description: "New password for the user",
+			Bytes:       []byte(generatedPassword),
+		},
+	}
+
+	return plaintextData, annos, nil
+}
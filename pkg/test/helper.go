@@ -51,6 +51,29 @@ var (
 			"source":      "default",
 		},
 	}
+
+	// Mock data for Nexus privileges.
+	Privileges = []map[string]interface{}{
+		{
+			"type":        "application",
+			"name":        "nx-all",
+			"description": "All permissions",
+			"domain":      "*",
+		},
+		{
+			"type":        "repository-view",
+			"name":        "nx-repository-view-maven2-*-read",
+			"description": "Read permission for all 'maven2'-format repository views",
+			"format":      "maven2",
+			"repository":  "*",
+		},
+		{
+			"type":        "wildcard",
+			"name":        "nx-healthcheck-read",
+			"description": "Read permission for Healthcheck",
+			"pattern":     "nexus:healthcheck:read",
+		},
+	}
 )
 
 // Custom RoundTripper for testing.
@@ -0,0 +1,460 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-sonatype-nexus/pkg/client"
+)
+
+// FakeNexus is an in-memory Nexus server used to exercise the client over real HTTP requests.
+// It counts every request it receives so tests can assert how many calls a sync makes.
+type FakeNexus struct {
+	Server *httptest.Server
+
+	mu           sync.Mutex
+	Users        []*client.User
+	Roles        []client.Role
+	Privileges   []client.Privilege
+	Repositories []client.Repository
+	LDAPServers  []client.LDAPServer
+	// ContentSelectors are the content selectors referenced by repository-content-selector privileges.
+	ContentSelectors []client.ContentSelector
+	// UserSources are the configured user sources, only the default source when empty.
+	UserSources []client.UserSource
+	// UserSearchLimit caps the users returned for a search on a source other than default, like LDAP does.
+	UserSearchLimit int
+	// Passwords holds the passwords set through the change-password endpoint, keyed by user ID.
+	Passwords map[string]string
+	// Denied lists request paths that are answered with 403 Forbidden.
+	Denied []string
+	// UpdateHook is called with every user stored by an update while the server is locked,
+	// so that tests can simulate another client changing the user at the same time.
+	UpdateHook func(user *client.User)
+	// RoleUpdateHook is called with every role stored by an update while the server is locked.
+	RoleUpdateHook func(role *client.Role)
+	requests       map[string]int
+}
+
+// NewFakeNexus starts a fake Nexus server that is shut down when the test finishes.
+// The HTTP cache of the SDK is disabled so that every client call reaches the server.
+func NewFakeNexus(t testing.TB) *FakeNexus {
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "true")
+
+	f := &FakeNexus{
+		Passwords: make(map[string]string),
+		requests:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /service/rest/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /service/rest/v1/security/user-sources", func(w http.ResponseWriter, r *http.Request) {
+		sources := f.UserSources
+		if len(sources) == 0 {
+			sources = []client.UserSource{{ID: client.DefaultUserSource, Name: "Local"}}
+		}
+		f.writeJSON(w, sources)
+	})
+	mux.HandleFunc("GET /service/rest/v1/security/users", f.listUsers)
+	mux.HandleFunc("POST /service/rest/v1/security/users", f.createUser)
+	mux.HandleFunc("PUT /service/rest/v1/security/users/{userId}", f.updateUser)
+	mux.HandleFunc("PUT /service/rest/v1/security/users/{userId}/change-password", f.changePassword)
+	mux.HandleFunc("DELETE /service/rest/v1/security/users/{userId}", f.deleteUser)
+	mux.HandleFunc("GET /service/rest/v1/security/roles", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, f.Roles)
+	})
+	mux.HandleFunc("GET /service/rest/v1/security/roles/{roleId}", func(w http.ResponseWriter, r *http.Request) {
+		role := f.Role(r.PathValue("roleId"))
+		if role == nil {
+			writeError(w, http.StatusNotFound, "role not found")
+			return
+		}
+		f.writeJSON(w, role)
+	})
+	mux.HandleFunc("POST /service/rest/v1/security/roles", f.createRole)
+	mux.HandleFunc("PUT /service/rest/v1/security/roles/{roleId}", f.updateRole)
+	mux.HandleFunc("DELETE /service/rest/v1/security/roles/{roleId}", f.deleteRole)
+	mux.HandleFunc("GET /service/rest/v1/security/privileges", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, f.Privileges)
+	})
+	mux.HandleFunc("POST /service/rest/v1/security/privileges/{type}", f.createPrivilege)
+	mux.HandleFunc("DELETE /service/rest/v1/security/privileges/{name}", f.deletePrivilege)
+	mux.HandleFunc("GET /service/rest/v1/security/content-selectors", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, f.ContentSelectors)
+	})
+	mux.HandleFunc("GET /service/rest/v1/repositorySettings", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, f.Repositories)
+	})
+	mux.HandleFunc("GET /service/rest/v1/repositories", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		repositories := make([]client.Repository, 0, len(f.Repositories))
+		for _, repository := range f.Repositories {
+			repositories = append(repositories, client.Repository{
+				Name:   repository.Name,
+				Format: repository.Format,
+				Type:   repository.Type,
+				URL:    repository.URL,
+			})
+		}
+		f.mu.Unlock()
+		f.writeJSON(w, repositories)
+	})
+	mux.HandleFunc("GET /service/rest/v1/security/ldap", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, f.LDAPServers)
+	})
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests[r.Method+" "+r.URL.Path]++
+		denied := slices.Contains(f.Denied, r.URL.Path)
+		f.mu.Unlock()
+
+		// The status endpoint is available anonymously, like in Nexus.
+		username, password, ok := r.BasicAuth()
+		if r.URL.Path != "/service/rest/v1/status" && (!ok || username != "admin" || password != "admin123") {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if denied {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Server.Close)
+
+	return f
+}
+
+// Client returns an API client pointed at the fake server.
+func (f *FakeNexus) Client(t testing.TB) *client.APIClient {
+	return f.ClientWithPassword(t, "admin123")
+}
+
+// ClientWithPassword returns an API client pointed at the fake server that authenticates as admin with the given password.
+func (f *FakeNexus) ClientWithPassword(t testing.TB, password string) *client.APIClient {
+	httpClient := &http.Client{
+		Transport: &basicAuthTransport{username: "admin", password: password, base: f.Server.Client().Transport},
+	}
+	c, err := client.NewClient(context.Background(), f.Server.URL, "admin", password, httpClient)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c
+}
+
+// Requests returns how many requests were made with the given method and path.
+func (f *FakeNexus) Requests(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method+" "+path]
+}
+
+// User returns a copy of the stored user with the given ID, or nil if there is none.
+func (f *FakeNexus) User(userID string) *client.User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.Users {
+		if u.UserID == userID {
+			userCopy := *u
+			userCopy.Roles = append([]string(nil), u.Roles...)
+			return &userCopy
+		}
+	}
+	return nil
+}
+
+func (f *FakeNexus) listUsers(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("userId")
+	source := r.URL.Query().Get("source")
+
+	f.mu.Lock()
+	users := make([]*client.User, 0, len(f.Users))
+	for _, u := range f.Users {
+		if source != "" && u.Source != source {
+			continue
+		}
+		if strings.HasPrefix(u.UserID, userID) {
+			users = append(users, u)
+		}
+	}
+	if source != "" && source != client.DefaultUserSource && f.UserSearchLimit > 0 && len(users) > f.UserSearchLimit {
+		users = users[:f.UserSearchLimit]
+	}
+	f.mu.Unlock()
+
+	f.writeJSON(w, users)
+}
+
+func (f *FakeNexus) createUser(w http.ResponseWriter, r *http.Request) {
+	var payload client.UserCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	user := &client.User{
+		UserID:       payload.UserID,
+		FirstName:    payload.FirstName,
+		LastName:     payload.LastName,
+		EmailAddress: payload.EmailAddress,
+		Status:       payload.Status,
+		Source:       "default",
+		Roles:        payload.Roles,
+	}
+
+	f.mu.Lock()
+	f.Users = append(f.Users, user)
+	f.mu.Unlock()
+
+	f.writeJSON(w, user)
+}
+
+func (f *FakeNexus) updateUser(w http.ResponseWriter, r *http.Request) {
+	var payload client.User
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	// Like Nexus, the user is looked up in the source sent with the update. Only the Nexus-side
+	// role mapping of LDAP, SAML and Crowd users can be changed.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, u := range f.Users {
+		if u.UserID != r.PathValue("userId") || u.Source != payload.Source {
+			continue
+		}
+
+		if u.Source == client.DefaultUserSource {
+			// Nexus validates that local users keep at least one role.
+			if len(payload.Roles) == 0 {
+				writeError(w, http.StatusBadRequest, "roles: must not be empty")
+				return
+			}
+			f.Users[i] = &payload
+		} else {
+			userCopy := *u
+			userCopy.Roles = payload.Roles
+			f.Users[i] = &userCopy
+		}
+		if f.UpdateHook != nil {
+			f.UpdateHook(f.Users[i])
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "user not found")
+}
+
+func (f *FakeNexus) deleteUser(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, u := range f.Users {
+		if u.UserID == r.PathValue("userId") && u.Source == client.DefaultUserSource {
+			f.Users = slices.Delete(f.Users, i, i+1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "user not found")
+}
+
+func (f *FakeNexus) changePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "text/plain" {
+		writeError(w, http.StatusUnsupportedMediaType, "expected a text/plain password")
+		return
+	}
+
+	password, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.Users {
+		if u.UserID == r.PathValue("userId") && u.Source == "default" {
+			f.Passwords[u.UserID] = string(password)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "user not found")
+}
+
+// Role returns a copy of the stored role with the given ID, or nil if there is none.
+func (f *FakeNexus) Role(roleID string) *client.Role {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.Roles {
+		if r.ID == roleID {
+			roleCopy := r
+			return &roleCopy
+		}
+	}
+	return nil
+}
+
+func (f *FakeNexus) createRole(w http.ResponseWriter, r *http.Request) {
+	var payload client.RolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	role := client.Role{
+		ID:          payload.ID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Source:      client.DefaultUserSource,
+		Privileges:  payload.Privileges,
+		Roles:       payload.Roles,
+	}
+
+	f.mu.Lock()
+	f.Roles = append(f.Roles, role)
+	f.mu.Unlock()
+
+	f.writeJSON(w, role)
+}
+
+func (f *FakeNexus) updateRole(w http.ResponseWriter, r *http.Request) {
+	var payload client.RolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, role := range f.Roles {
+		if role.ID != r.PathValue("roleId") {
+			continue
+		}
+		if role.ReadOnly {
+			writeError(w, http.StatusBadRequest, "role is read-only")
+			return
+		}
+
+		f.Roles[i].Name = payload.Name
+		f.Roles[i].Description = payload.Description
+		f.Roles[i].Privileges = payload.Privileges
+		f.Roles[i].Roles = payload.Roles
+		if f.RoleUpdateHook != nil {
+			f.RoleUpdateHook(&f.Roles[i])
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "role not found")
+}
+
+func (f *FakeNexus) deleteRole(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, role := range f.Roles {
+		if role.ID == r.PathValue("roleId") && !role.ReadOnly {
+			f.Roles = slices.Delete(f.Roles, i, i+1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "role not found")
+}
+
+// Privilege returns a copy of the stored privilege with the given name, or nil if there is none.
+func (f *FakeNexus) Privilege(name string) *client.Privilege {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.Privileges {
+		if p.Name == name {
+			privilegeCopy := p
+			return &privilegeCopy
+		}
+	}
+	return nil
+}
+
+func (f *FakeNexus) createPrivilege(w http.ResponseWriter, r *http.Request) {
+	var payload client.PrivilegePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Privileges = append(f.Privileges, client.Privilege{
+		Type:            r.PathValue("type"),
+		Name:            payload.Name,
+		Description:     payload.Description,
+		Format:          payload.Format,
+		Repository:      payload.Repository,
+		ContentSelector: payload.ContentSelector,
+		Pattern:         payload.Pattern,
+		Actions:         payload.Actions,
+	})
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *FakeNexus) deletePrivilege(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, p := range f.Privileges {
+		if p.Name == r.PathValue("name") && !p.ReadOnly {
+			f.Privileges = slices.Delete(f.Privileges, i, i+1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "privilege not found")
+}
+
+func (f *FakeNexus) writeJSON(w http.ResponseWriter, v any) {
+	f.mu.Lock()
+	data, err := json.Marshal(v)
+	f.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// basicAuthTransport adds basic auth to requests, as the client only does so for the HTTP clients it creates itself.
+type basicAuthTransport struct {
+	username string
+	password string
+	base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.base.RoundTrip(req)
+}